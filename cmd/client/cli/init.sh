@@ -1,4 +1,3 @@
 #!/bin/bash
 ln -s ../../../parameter.default.yaml parameter.default.yaml
 ln -s ../../../policy.example.yaml policy.yaml
-ln -s ../../server/radvd.template.conf radvd.template.conf
\ No newline at end of file
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 	"sync"
 
@@ -16,27 +18,64 @@ const (
 )
 
 func main() {
-	execFlag := flag.String("x", "", "[status|apply|update|delete]")
-	fileFlag := flag.String("f", "", "Policy file")
+	execFlag := flag.String("x", "", "[status|plan|apply|update|delete|fmt|lint]")
+	fileFlag := flag.String("f", "", "Policy file, or radvd.conf for fmt")
+	paramFlag := flag.String("p", radvd.DefaultParameterFile, "Parameter file of the routers")
+	writeFlag := flag.Bool("w", false, "Write the result of fmt to the file instead of stdout")
+	debugDirFlag := flag.String("debug-dir", "", "Write the compiled radvd configs to this directory")
+	outputFlag := flag.String("o", "text", "Output format of plan and lint [text|json]")
+	caFlag := flag.String("ca", "", "CA bundle to verify the servers (enables HTTPS)")
+	certFlag := flag.String("cert", "", "Client certificate for mutual TLS (enables HTTPS)")
+	keyFlag := flag.String("key", "", "Client key for mutual TLS")
+	httpsFlag := flag.Bool("https", false, "Use HTTPS, implied by -ca and -cert")
+	tokenFlag := flag.String("token", os.Getenv("RADVD_MANAGER_TOKEN"), "Bearer token, requires HTTPS (env: RADVD_MANAGER_TOKEN)")
 	flag.Parse()
 
 	if *execFlag == "" {
-		log.Fatalf("Use -x [status|apply|update|delete]")
+		log.Fatalf("Use -x [status|plan|apply|update|delete|fmt|lint]")
 	}
-	policy, err := radvd.LoadPolicyFile(*fileFlag)
+	if *execFlag == "fmt" {
+		format_conf(*fileFlag, *writeFlag)
+		return
+	}
+	if *execFlag == "lint" {
+		lint_policy(*fileFlag, *paramFlag, *outputFlag)
+		return
+	}
+	parameters, err := radvd.LoadParameterFile(*paramFlag)
+	if err != nil {
+		log.Fatalf("Failed to load parameter file: %v", err)
+	}
+	policy, err := radvd.LoadPolicyFile(*fileFlag, parameters)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
-	show_policy(policy)
-	instances, err := radvd.ParsePolicy(policy)
+	if *execFlag != "plan" || *outputFlag != "json" {
+		show_policy(policy)
+	}
+	instances, err := radvd.Compile(policy, parameters)
 	if err != nil {
 		log.Fatalf("Failed to convert policy to radvd instance: %v", err)
 	}
-	// create clients
-	routers := client.GetSiteExitRouters(instances)
+	if *debugDirFlag != "" {
+		if err := radvd.GenerateRadvdConfigFiles(instances, *debugDirFlag); err != nil {
+			log.Fatalf("Failed to write radvd configs: %v", err)
+		}
+	}
+	// create clients for every known router, so that routers whose rules
+	// were all removed from the policy are reconciled as well
+	routers := client.GetSiteExitRouters(append(instances, parameters...))
+	auth := client.ClientAuth{CA: *caFlag, Cert: *certFlag, Key: *keyFlag, Token: *tokenFlag, HTTPS: *httpsFlag}
+	scheme := "http"
+	if auth.TLS() {
+		scheme = "https"
+	}
 	clients := make([]*client.RadvdManagerClient, len(routers))
 	for i, r := range routers {
-		client := client.NewClient(fmt.Sprintf("http://[%s]:%d", r, port), r, port)
+		client := client.NewClient(fmt.Sprintf("%s://[%s]:%d", scheme, r, port), r, port)
+		if err := client.SetAuth(auth); err != nil {
+			log.Fatalf("Failed to configure client: %v", err)
+		}
 		clients[i] = client
 	}
 
@@ -49,35 +88,86 @@ func main() {
 			}
 		}
 		show_status(clients)
-	case "apply":
+	case "plan":
+		var changes []client.Change
+		for _, c := range clients {
+			if err := c.GetInstances(); err != nil {
+				log.Fatalf("Failed to get radvd instances from %s: %v", c.Server, err)
+			}
+			changes = append(changes, c.Plan(instances)...)
+		}
+		switch *outputFlag {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if changes == nil {
+				changes = []client.Change{}
+			}
+			if err := enc.Encode(changes); err != nil {
+				log.Fatalf("Failed to encode plan: %v", err)
+			}
+		case "text":
+			show_plan(clients, changes)
+		default:
+			log.Fatalf("Unknown output format: %s. Use text or json", *outputFlag)
+		}
+	case "apply", "update":
+		// "update" only creates and updates instances, "apply" also prunes
+		// instances that are no longer in the policy.
+		var failures reconcileErrors
 		var clientWg sync.WaitGroup
 		for _, c := range clients {
 			// gorutine for each client
 			clientWg.Add(1)
 			go func(c *client.RadvdManagerClient) {
 				defer clientWg.Done()
+				if err := c.GetInstances(); err != nil {
+					failures.add(fmt.Errorf("failed to get radvd instances from %s: %w", c.Server, err))
+					return
+				}
+				changes := c.Plan(instances)
+				if len(changes) == 0 {
+					log.Printf("= No changes on %s", c.Server)
+					return
+				}
+				// create and update first, then delete to avoid RA outage
 				var instanceWg sync.WaitGroup
-				for _, i := range instances {
-					if i.RouterID == c.Server {
-						// gorutine for each instance in the client
+				for _, change := range changes {
+					if change.Action == client.ActionDelete {
+						continue
+					}
+					// gorutine for each instance in the client
+					instanceWg.Add(1)
+					go func(change client.Change) {
+						defer instanceWg.Done()
+						failures.add(apply_change(c, change))
+					}(change)
+				}
+				instanceWg.Wait()
+				if *execFlag == "update" {
+					return
+				}
+				for _, change := range changes {
+					if change.Action == client.ActionDelete {
 						instanceWg.Add(1)
-						go func(instance *radvd.Instance) {
+						go func(change client.Change) {
 							defer instanceWg.Done()
-							err := c.CreateInstance(int(i.ID), instance)
-							if err != nil {
-								log.Printf("Failed to create radvd instance: %v", err)
-							} else {
-								log.Printf("+ Created radvd instance (id: %d) on %s", i.ID, c.Server)
-							}
-						}(i)
+							failures.add(apply_change(c, change))
+						}(change)
 					}
 				}
 				instanceWg.Wait()
 			}(c)
 		}
 		clientWg.Wait()
-	case "update":
-		break
+		// a partly applied policy must not look successful to scripts
+		if errs := failures.list(); len(errs) > 0 {
+			log.Printf("%s failed, %d error(s):", *execFlag, len(errs))
+			for _, err := range errs {
+				log.Printf("  %v", err)
+			}
+			os.Exit(1)
+		}
 	case "delete":
 		for _, c := range clients {
 			err := c.DeleteInstances()
@@ -90,6 +180,98 @@ func main() {
 	}
 }
 
+// reconcileErrors collects the errors of the concurrent requests of apply and update.
+type reconcileErrors struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (e *reconcileErrors) add(err error) {
+	if err == nil {
+		return
+	}
+	log.Print(err)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errs = append(e.errs, err)
+}
+
+func (e *reconcileErrors) list() []error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]error(nil), e.errs...)
+}
+
+func apply_change(c *client.RadvdManagerClient, change client.Change) error {
+	if err := c.Apply(change); err != nil {
+		return fmt.Errorf("failed to %s radvd instance (id: %d) on %s: %w", change.Action, change.ID, c.Server, err)
+	}
+	switch change.Action {
+	case client.ActionCreate:
+		log.Printf("+ Created radvd instance (id: %d) on %s", change.ID, c.Server)
+	case client.ActionUpdate:
+		log.Printf("~ Updated radvd instance (id: %d) on %s", change.ID, c.Server)
+	case client.ActionDelete:
+		log.Printf("- Deleted radvd instance (id: %d) on %s", change.ID, c.Server)
+	}
+	return nil
+}
+
+// format_conf formats radvd.conf canonically, keeping comments and unknown directives.
+func format_conf(file string, write bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Fatalf("Failed to read radvd.conf: %v", err)
+	}
+	conf, err := radvd.ParseRadvdConf(file, data)
+	if err != nil {
+		log.Fatalf("Failed to parse radvd.conf: %v", err)
+	}
+	formatted := radvd.FormatRadvdConf(conf)
+	if !write {
+		os.Stdout.Write(formatted)
+		return
+	}
+	if err := os.WriteFile(file, formatted, 0644); err != nil {
+		log.Fatalf("Failed to write radvd.conf: %v", err)
+	}
+}
+
+// lint_policy prints the violations and lint findings of the policy and exits
+// with 1 if one of them is an error, so that it can be used as a pre-commit hook.
+func lint_policy(file string, parameterFile string, output string) {
+	parameters, err := radvd.LoadParameterFile(parameterFile)
+	if err != nil {
+		log.Fatalf("Failed to load parameter file: %v", err)
+	}
+	findings, err := radvd.LintPolicyFile(file, parameters)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if findings == nil {
+			findings = []radvd.LintFinding{}
+		}
+		if err := enc.Encode(findings); err != nil {
+			log.Fatalf("Failed to encode findings: %v", err)
+		}
+	case "text":
+		for _, f := range findings {
+			fmt.Printf("%s:%s\n", file, f)
+		}
+	default:
+		log.Fatalf("Unknown output format: %s. Use text or json", output)
+	}
+	for _, f := range findings {
+		if f.Severity == radvd.LintError {
+			os.Exit(1)
+		}
+	}
+}
+
 func show_policy(policy *radvd.Policy) {
 	fmt.Println("[Local Policy]")
 	fmt.Printf("%-12s %-40s %-20s\n", "ID(common)", "Prefixes", "Nexthop")
@@ -98,16 +280,56 @@ func show_policy(policy *radvd.Policy) {
 		prefixes := "[" + strings.Join(i.Prefixes, " ") + "]"
 		fmt.Printf("%-12d %-40s %-20s\n", i.ID, prefixes, i.Nexthop)
 	}
-	fmt.Println("\nRules                Members")
+	fmt.Printf("\n%-20s %-30s %-30s\n", "Rules", "Members", "Search domains")
 	fmt.Println(strings.Repeat("-", 80))
 	for _, i := range policy.Groups {
 		rules := strings.Join(strings.Fields(fmt.Sprint(i.Rules)), " ")
 		members := "[" + strings.Join(i.Members, " ") + "]"
-		fmt.Printf("%-20s %-30s\n", rules, members)
+		domains := "[" + strings.Join(i.Dnssl, " ") + "]"
+		fmt.Printf("%-20s %-30s %-30s\n", rules, members, domains)
 	}
 	fmt.Println()
 }
 
+func show_plan(clients []*client.RadvdManagerClient, changes []client.Change) {
+	fmt.Println("[Plan]")
+	for _, c := range clients {
+		fmt.Println(c.Server)
+		fmt.Println(strings.Repeat("-", 80))
+		n := 0
+		for _, change := range changes {
+			if change.Server != c.Server {
+				continue
+			}
+			n++
+			switch change.Action {
+			case client.ActionCreate:
+				fmt.Printf("+ instance %d (create)\n", change.ID)
+			case client.ActionUpdate:
+				fmt.Printf("~ instance %d (update)\n", change.ID)
+			case client.ActionDelete:
+				fmt.Printf("- instance %d (delete)\n", change.ID)
+			}
+			for _, d := range change.Diff {
+				if d.Added == nil && d.Removed == nil {
+					fmt.Printf("    %-24s %s -> %s\n", d.Field+":", d.Old, d.New)
+					continue
+				}
+				for _, a := range d.Added {
+					fmt.Printf("    %-24s + %s\n", d.Field+":", a)
+				}
+				for _, r := range d.Removed {
+					fmt.Printf("    %-24s - %s\n", d.Field+":", r)
+				}
+			}
+		}
+		if n == 0 {
+			fmt.Println("  no changes")
+		}
+		fmt.Println()
+	}
+}
+
 func show_status(clients []*client.RadvdManagerClient) {
 	fmt.Println("[Remote Status]")
 	fmt.Printf("%-20s %-12s %-8s %-40s %-12s %-30s\n", "RouterID", "ID(common)", "PID", "Routes", "Preference", "Clients")
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type contextKey string
+
+const identityKey contextKey = "identity"
+
+// Token is a bearer token accepted by the server and the identity it authenticates.
+type Token struct {
+	Identity string `yaml:"identity" validate:"required"`
+	Token    string `yaml:"token" validate:"required,min=16"`
+}
+
+// ServerTLSConfig returns the TLS config of the server. When TLS.ClientCA is set,
+// clients must present a certificate signed by it. If tokens are configured as
+// well, a valid bearer token is accepted instead of the certificate.
+func (c *ServerConfig) ServerTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.TLS.ClientCA == "" {
+		return config, nil
+	}
+	pool, err := loadCertPool(c.TLS.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if len(c.Tokens) > 0 {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// authenticate identifies the caller by its verified client certificate or its
+// bearer token. When neither client certificates nor tokens are configured,
+// every caller is accepted as "anonymous".
+func (s *RadvdManagerServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var identity string
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			identity = "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+		if header := r.Header.Get("Authorization"); header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			name, valid := s.lookupToken(token)
+			if !ok || !valid {
+				s.logger.Error("Invalid bearer token", "from", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="radvd-manager"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			identity = "token:" + name
+		}
+		if identity == "" {
+			if len(s.tokens) > 0 || s.requireCert {
+				s.logger.Error("Unauthenticated request", "from", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="radvd-manager"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			identity = "anonymous"
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, identity)))
+	})
+}
+
+func (s *RadvdManagerServer) lookupToken(token string) (string, bool) {
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return t.Identity, true
+		}
+	}
+	return "", false
+}
+
+// identityOf returns the authenticated identity of the request.
+func identityOf(r *http.Request) string {
+	identity, _ := r.Context().Value(identityKey).(string)
+	return identity
+}
+
+// authTransport adds the bearer token to every request of the client.
+type authTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(r)
+}
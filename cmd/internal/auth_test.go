@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+const testToken = "0123456789abcdef0123"
+
+// testPKI is a CA with a server certificate for 127.0.0.1 and a client certificate,
+// written as PEM files to a temporary directory.
+type testPKI struct {
+	CA, ServerCert, ServerKey, ClientCert, ClientKey string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := writePEM(t, filepath.Join(dir, name+".crt"), "CERTIFICATE", der)
+		return cert, writePEM(t, filepath.Join(dir, name+".key"), "EC PRIVATE KEY", keyDER)
+	}
+	pki := testPKI{CA: writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", caDER)}
+	pki.ServerCert, pki.ServerKey = issue("server", 2, x509.ExtKeyUsageServerAuth)
+	pki.ClientCert, pki.ClientKey = issue("controller", 3, x509.ExtKeyUsageClientAuth)
+	return pki
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTLSServer serves the fake server over HTTPS with the TLS settings of config.
+func newTLSServer(t *testing.T, pki testPKI, config *ServerConfig) *httptest.Server {
+	t.Helper()
+	config.TLS.Cert, config.TLS.Key = pki.ServerCert, pki.ServerKey
+	tlsConfig, err := config.ServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.LoadX509KeyPair(pki.ServerCert, pki.ServerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	manager, _, _ := radvd.NewFakeManager()
+	srv := NewServer("", nil, slog.New(slog.NewTextHandler(io.Discard, nil)), ServerOptions{
+		Manager:           manager,
+		Tokens:            config.Tokens,
+		RequireClientCert: config.TLS.ClientCA != "",
+	})
+	ts := httptest.NewUnstartedServer(srv.Handler)
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestClientTokenRequiresHTTPS(t *testing.T) {
+	c := NewClient("http://[::1]:12345", "::1", 12345)
+	if err := c.SetAuth(ClientAuth{Token: testToken}); err == nil {
+		t.Fatal("SetAuth accepted a token over plain HTTP")
+	}
+	// -https without switching the URL to https:// is refused as well
+	if err := c.SetAuth(ClientAuth{Token: testToken, HTTPS: true}); err == nil {
+		t.Fatal("SetAuth accepted a token for an http:// URL")
+	}
+	if err := c.SetAuth(ClientAuth{}); err != nil {
+		t.Fatalf("SetAuth without a token: %v", err)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	pki := newTestPKI(t)
+	ts := newTLSServer(t, pki, &ServerConfig{Tokens: []Token{{Identity: "controller", Token: testToken}}})
+
+	c := NewClient(ts.URL, "127.0.0.1", 0)
+	if err := c.SetAuth(ClientAuth{CA: pki.CA, Token: testToken}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetInstances(); err != nil {
+		t.Fatalf("GetInstances with a token: %v", err)
+	}
+
+	for name, auth := range map[string]ClientAuth{
+		"bad token": {CA: pki.CA, Token: "fedcba9876543210fedc"},
+		"no token":  {CA: pki.CA},
+	} {
+		c := NewClient(ts.URL, "127.0.0.1", 0)
+		if err := c.SetAuth(auth); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Get(ts.URL + pathInstances)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: %s, want 401 with WWW-Authenticate", name, resp.Status)
+		}
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	pki := newTestPKI(t)
+	ts := newTLSServer(t, pki, &ServerConfig{TLS: TLSConfig{ClientCA: pki.CA}})
+
+	c := NewClient(ts.URL, "127.0.0.1", 0)
+	if err := c.SetAuth(ClientAuth{CA: pki.CA, Cert: pki.ClientCert, Key: pki.ClientKey}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetInstances(); err != nil {
+		t.Fatalf("GetInstances with a client certificate: %v", err)
+	}
+
+	// the handshake fails without a client certificate
+	c = NewClient(ts.URL, "127.0.0.1", 0)
+	if err := c.SetAuth(ClientAuth{CA: pki.CA}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := c.Get(ts.URL + pathInstances); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request without a client certificate: %s", resp.Status)
+	}
+	// a server certificate not signed by the CA is rejected by the client
+	c = NewClient(ts.URL, "127.0.0.1", 0)
+	if err := c.SetAuth(ClientAuth{HTTPS: true, Cert: pki.ClientCert, Key: pki.ClientKey}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := c.Get(ts.URL + pathInstances); err == nil {
+		resp.Body.Close()
+		t.Fatal("server certificate was accepted without the CA")
+	}
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// AuthzPolicy restricts what authenticated identities may do.
+// A request is allowed if any rule matching its identity allows it.
+type AuthzPolicy struct {
+	Rules []AuthzRule `yaml:"rules" validate:"required,dive"`
+}
+
+type AuthzRule struct {
+	// Identity is the authenticated identity, e.g. "cert:controller" or "token:monitor".
+	// "*" matches every identity.
+	Identity string   `yaml:"identity" validate:"required"`
+	Methods  []string `yaml:"methods" validate:"required,dive,oneof=GET POST PUT DELETE"`
+	// Instances limits the rule to ID ranges such as "100-199" or "5".
+	// Empty allows every ID.
+	Instances []string `yaml:"instances" validate:"dive,id_range"`
+}
+
+func LoadAuthzPolicy(path string) (*AuthzPolicy, error) {
+	fileData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization policy: %w", err)
+	}
+	var policy AuthzPolicy
+	decoder := yaml.NewDecoder(bytes.NewReader(fileData))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse authorization policy %s: %w", path, err)
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterValidation("id_range", func(fl validator.FieldLevel) bool {
+		_, _, err := parseIDRange(fl.Field().String())
+		return err == nil
+	})
+	if err := validate.Struct(&policy); err != nil {
+		return nil, fmt.Errorf("invalid authorization policy %s: %w", path, err)
+	}
+
+	return &policy, nil
+}
+
+// Allowed reports whether the identity may use the method on the instance.
+// An instance of -1 means the whole collection, which is only allowed to
+// rules that are not limited to ID ranges.
+func (p *AuthzPolicy) Allowed(identity string, method string, instance int) bool {
+	for _, rule := range p.Rules {
+		if rule.Identity != "*" && rule.Identity != identity {
+			continue
+		}
+		if !contains(rule.Methods, method) {
+			continue
+		}
+		if len(rule.Instances) == 0 {
+			return true
+		}
+		if instance < 0 {
+			continue
+		}
+		for _, r := range rule.Instances {
+			from, to, _ := parseIDRange(r)
+			if from <= instance && instance <= to {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorize rejects requests that are not allowed by the authorization policy.
+// Mutating the default instance (id: 0) is never allowed.
+func (s *RadvdManagerServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := identityOf(r)
+		method := r.Method
+		if method == http.MethodHead || method == http.MethodOptions {
+			method = http.MethodGet
+		}
+		instance := -1
+		if v, ok := mux.Vars(r)["instance"]; ok {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				// left to the handler to report
+				next.ServeHTTP(w, r)
+				return
+			}
+			instance = int(id)
+		}
+		if instance == 0 && method != http.MethodGet {
+			s.logger.Error("Access denied", "identity", identity, "method", method, "instance", instance)
+			writeErrors(w, http.StatusForbidden, Error{
+				Type:    "protocol",
+				Tag:     "access-denied",
+				Path:    r.URL.Path,
+				Message: "the default instance (id: 0) is read-only",
+			})
+			return
+		}
+		// the collection GET is filtered per instance by the handler,
+		// the RESTCONF collection POST is checked once the body is decoded
+		deferred := instance < 0 && (method == http.MethodGet || method == http.MethodPost)
+		if s.authz != nil && !deferred && !s.authz.Allowed(identity, method, instance) {
+			s.logger.Error("Access denied", "identity", identity, "method", method, "instance", instance)
+			writeErrors(w, http.StatusForbidden, Error{
+				Type:    "protocol",
+				Tag:     "access-denied",
+				Path:    r.URL.Path,
+				Message: fmt.Sprintf("%s is not allowed to %s this resource", identity, method),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// visible reports whether the caller may see the instance in the collection GET.
+func (s *RadvdManagerServer) visible(r *http.Request, instance uint32) bool {
+	return s.authz == nil || s.authz.Allowed(identityOf(r), http.MethodGet, int(instance))
+}
+
+func parseIDRange(r string) (int, int, error) {
+	fromStr, toStr, found := strings.Cut(r, "-")
+	if !found {
+		toStr = fromStr
+	}
+	from, err := strconv.ParseUint(strings.TrimSpace(fromStr), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid ID range: %s", r)
+	}
+	to, err := strconv.ParseUint(strings.TrimSpace(toStr), 10, 32)
+	if err != nil || to < from {
+		return 0, 0, fmt.Errorf("invalid ID range: %s", r)
+	}
+	return int(from), int(to), nil
+}
+
+func contains(slice []string, item string) bool {
+	for _, v := range slice {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
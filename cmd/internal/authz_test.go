@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+func TestAuthzPolicyAllowed(t *testing.T) {
+	policy, err := LoadAuthzPolicy("../../authz.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		identity string
+		method   string
+		instance int
+		allowed  bool
+	}{
+		{"token:monitor", "GET", 5, true},
+		{"token:monitor", "GET", -1, true},
+		{"token:monitor", "PUT", 5, false},
+		{"cert:controller", "DELETE", -1, true},
+		{"cert:tenant-a", "PUT", 100, true},
+		{"cert:tenant-a", "PUT", 199, true},
+		{"cert:tenant-a", "PUT", 200, false},
+		{"cert:tenant-a", "DELETE", -1, false},
+		{"anonymous", "GET", 5, false},
+	} {
+		if got := policy.Allowed(c.identity, c.method, c.instance); got != c.allowed {
+			t.Errorf("%s %s %d: allowed = %v, want %v", c.identity, c.method, c.instance, got, c.allowed)
+		}
+	}
+}
+
+func TestLoadAuthzPolicyInvalid(t *testing.T) {
+	for name, policy := range map[string]string{
+		"method":  "rules:\n  - identity: x\n    methods: [PATCH]\n",
+		"range":   "rules:\n  - identity: x\n    methods: [GET]\n    instances: [\"9-1\"]\n",
+		"unknown": "rules:\n  - identity: x\n    methods: [GET]\n    ids: [1]\n",
+	} {
+		file := filepath.Join(t.TempDir(), "authz.yaml")
+		os.WriteFile(file, []byte(policy), 0644)
+		if _, err := LoadAuthzPolicy(file); err == nil {
+			t.Errorf("%s: invalid policy accepted", name)
+		}
+	}
+}
+
+func TestServerAuthorization(t *testing.T) {
+	policy := &AuthzPolicy{Rules: []AuthzRule{
+		{Identity: "token:monitor", Methods: []string{"GET"}},
+		{Identity: "token:tenant", Methods: []string{"GET", "POST", "PUT", "DELETE"}, Instances: []string{"100-199"}},
+	}}
+	ts, _, _, _ := newTestServer(t, ServerOptions{
+		Tokens: []Token{
+			{Identity: "monitor", Token: "monitor-token-0123456789"},
+			{Identity: "tenant", Token: "tenant-token-0123456789"},
+		},
+		Authz: policy,
+	})
+	request := func(token, method, path string, body any) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, jsonBody(t, body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	const monitor, tenant = "monitor-token-0123456789", "tenant-token-0123456789"
+
+	for _, c := range []struct {
+		token  string
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{"", "GET", "/rest/data/radvd:instances", nil, http.StatusUnauthorized},
+		{"wrong-token-0123456789", "GET", "/rest/data/radvd:instances", nil, http.StatusUnauthorized},
+		{tenant, "POST", "/rest/data/radvd:instances/100", testInstance(100), http.StatusCreated},
+		{tenant, "POST", "/rest/data/radvd:instances/5", testInstance(5), http.StatusForbidden},
+		{monitor, "GET", "/rest/data/radvd:instances/100", nil, http.StatusOK},
+		{monitor, "DELETE", "/rest/data/radvd:instances/100", nil, http.StatusForbidden},
+		{tenant, "DELETE", "/rest/data/radvd:instances", nil, http.StatusForbidden},
+		{tenant, "PUT", "/rest/data/radvd:instances/0", testInstance(0), http.StatusForbidden},
+		{tenant, "DELETE", "/rest/data/radvd:instances/4294967396", nil, http.StatusBadRequest},
+		{tenant, "DELETE", "/rest/data/radvd:instances/100", nil, http.StatusNoContent},
+	} {
+		if status := request(c.token, c.method, c.path, c.body); status != c.status {
+			t.Errorf("%s %s: %d, want %d", c.method, c.path, status, c.status)
+		}
+	}
+}
+
+func TestServerInstanceIDOverflow(t *testing.T) {
+	ts, _, exec, fs := newTestServer(t, ServerOptions{})
+	// 4294967296 wraps to instance 0 in a uint32
+	for _, c := range []struct {
+		method string
+		path   string
+		body   any
+	}{
+		{"DELETE", "/rest/data/radvd:instances/4294967296", nil},
+		{"PUT", "/rest/data/radvd:instances/4294967296", testInstance(0)},
+		{"POST", "/rest/data/radvd:instances/4294967297", testInstance(1)},
+		{"GET", "/rest/data/radvd:instances/4294967296", nil},
+		{"DELETE", "/restconf/data/radvd:instances/instance=4294967296", nil},
+	} {
+		if resp := do(t, ts, c.method, c.path, c.body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s %s: %s, want 400", c.method, c.path, resp.Status)
+		}
+	}
+	if resp := do(t, ts, "GET", "/rest/data/radvd:instances/0", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET of the default instance: %s", resp.Status)
+	}
+	if _, err := fs.ReadFile(radvd.DefaultPaths().ConfFile(0)); err == nil {
+		t.Fatal("a config file was written for instance 0")
+	}
+	if running := exec.Running(); len(running) != 0 {
+		t.Fatalf("radvd was started: %v", running)
+	}
+}
@@ -2,12 +2,14 @@ package internal
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	radvd "github.com/y-kzm/go-radvd-manager"
 )
@@ -35,6 +37,56 @@ func NewClient(host string, server string, port int) *RadvdManagerClient {
 	}
 }
 
+// ClientAuth is the TLS and token configuration of the client.
+type ClientAuth struct {
+	// CA verifies the server certificate. Empty uses the system roots.
+	CA string
+	// Cert and Key are the client certificate for mutual TLS.
+	Cert string
+	Key  string
+	// Token is sent as a bearer token. It requires HTTPS.
+	Token string
+	// HTTPS talks HTTPS to the server without CA or client certificate.
+	HTTPS bool
+}
+
+// TLS reports whether the client talks HTTPS to the server.
+func (a ClientAuth) TLS() bool {
+	return a.HTTPS || a.CA != "" || a.Cert != ""
+}
+
+// SetAuth configures TLS and the bearer token of the client.
+// A token is refused without TLS, it would be sent in cleartext.
+func (c *RadvdManagerClient) SetAuth(auth ClientAuth) error {
+	if auth.Token != "" && (!auth.TLS() || !strings.HasPrefix(c.host, "https://")) {
+		return fmt.Errorf("refusing to send the bearer token without HTTPS, it would be sent in cleartext")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if auth.TLS() {
+		config := &tls.Config{MinVersion: tls.VersionTLS12}
+		if auth.CA != "" {
+			pool, err := loadCertPool(auth.CA)
+			if err != nil {
+				return err
+			}
+			config.RootCAs = pool
+		}
+		if auth.Cert != "" {
+			cert, err := tls.LoadX509KeyPair(auth.Cert, auth.Key)
+			if err != nil {
+				return fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = config
+	}
+	c.Client.Transport = transport
+	if auth.Token != "" {
+		c.Client.Transport = &authTransport{base: transport, token: auth.Token}
+	}
+	return nil
+}
+
 func GetSiteExitRouters(instances []*radvd.Instance) []string {
 	routers := make(map[string]struct{})
 	for _, i := range instances {
@@ -109,20 +161,54 @@ func (c *RadvdManagerClient) CreateInstance(id int, instance *radvd.Instance) er
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to create radvd instance: %s", res.Status)
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("failed to create radvd instance: %s, response: %s", res.Status, body)
 	}
 
 	return nil
 }
 
 // [PUT] /rest/data/radvd:instances/{instance}
-func (c *RadvdManagerClient) UpdateInstance(id int, iface *radvd.Instance) error {
+func (c *RadvdManagerClient) UpdateInstance(id int, instance *radvd.Instance) error {
+	jsonData, err := json.MarshalIndent(instance, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal struct to JSON: %v", err)
+	}
+	url := c.host + pathInstance + strconv.Itoa(id)
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("failed to update radvd instance: %s, response: %s", res.Status, body)
+	}
 
 	return nil
 }
 
 // [DELETE] /rest/data/radvd:instances/{instance}
-func (c *RadvdManagerClient) DeleteInstance(instance int) error {
+func (c *RadvdManagerClient) DeleteInstance(id int) error {
+	url := c.host + pathInstance + strconv.Itoa(id)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("failed to delete radvd instance: %s, response: %s", res.Status, body)
+	}
 
 	return nil
 }
@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"testing"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+func TestClientReconcile(t *testing.T) {
+	ts, _, _, _ := newTestServer(t, ServerOptions{})
+	c := NewClient(ts.URL, "fc00:abcd::a", 0)
+	local := []*radvd.Instance{testInstance(1), testInstance(2)}
+	for _, i := range local {
+		i.RouterID = "fc00:abcd::a"
+	}
+
+	apply := func() []Change {
+		t.Helper()
+		if err := c.GetInstances(); err != nil {
+			t.Fatal(err)
+		}
+		changes := c.Plan(local)
+		for _, change := range changes {
+			if err := c.Apply(change); err != nil {
+				t.Fatalf("%s %d: %v", change.Action, change.ID, err)
+			}
+		}
+		return changes
+	}
+	if changes := apply(); len(changes) != 2 {
+		t.Fatalf("first apply: %+v", changes)
+	}
+	if changes := apply(); len(changes) != 0 {
+		t.Fatalf("second apply is not a no-op: %+v", changes)
+	}
+	local[0].AdvDefaultLifetime = 600
+	local = local[:1]
+	changes := apply()
+	if len(changes) != 2 || changes[0].Action != ActionUpdate || changes[1].Action != ActionDelete {
+		t.Fatalf("changes: %+v", changes)
+	}
+	if changes := apply(); len(changes) != 0 {
+		t.Fatalf("apply after update is not a no-op: %+v", changes)
+	}
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+const envPrefix = "RADVD_MANAGER_"
+
+// ServerConfig is the configuration of the radvd manager server.
+// Values are taken from the defaults, the config file, the environment
+// (RADVD_MANAGER_*) and the command line flags, in this order.
+type ServerConfig struct {
+	Listen    string    `yaml:"listen" validate:"required,listen_addr"`
+	StateFile string    `yaml:"state_file"`
+	TLS       TLSConfig `yaml:"tls"`
+	Tokens    []Token   `yaml:"tokens" validate:"unique=Identity,dive"`
+	// AuthzPolicy is the authorization policy file. Empty allows every authenticated caller everything.
+	AuthzPolicy string      `yaml:"authz_policy" validate:"omitempty,file"`
+	Paths       radvd.Paths `yaml:"paths"`
+}
+
+type TLSConfig struct {
+	Cert string `yaml:"cert" validate:"required_with=Key,omitempty,file"`
+	Key  string `yaml:"key" validate:"required_with=Cert,omitempty,file"`
+	// ClientCA enables mutual TLS: clients must present a certificate signed by it.
+	ClientCA string `yaml:"client_ca" validate:"excluded_without=Cert,omitempty,file"`
+}
+
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Listen: "[::]:12345",
+		Paths:  radvd.DefaultPaths(),
+	}
+}
+
+// LoadServerConfig reads the config file on top of the defaults.
+// An empty path returns the defaults.
+func LoadServerConfig(path string) (*ServerConfig, error) {
+	config := DefaultServerConfig()
+	if path == "" {
+		return config, nil
+	}
+	fileData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(fileData))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("failed to parse server config %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Fields returns pointers to every setting keyed by its environment/flag name,
+// e.g. "tls_cert" is RADVD_MANAGER_TLS_CERT and -tls-cert.
+func (c *ServerConfig) Fields() map[string]*string {
+	return map[string]*string{
+		"listen":        &c.Listen,
+		"state_file":    &c.StateFile,
+		"tls_cert":      &c.TLS.Cert,
+		"tls_key":       &c.TLS.Key,
+		"tls_client_ca": &c.TLS.ClientCA,
+		"authz_policy":  &c.AuthzPolicy,
+		"radvd":         &c.Paths.Radvd,
+		"conf_dir":      &c.Paths.ConfDir,
+		"pid_dir":       &c.Paths.PIDDir,
+		"default_conf":  &c.Paths.DefaultConf,
+		"template_dir":  &c.Paths.TemplateDir,
+	}
+}
+
+// ApplyEnv overrides the settings with the RADVD_MANAGER_* environment variables.
+func (c *ServerConfig) ApplyEnv() {
+	for name, value := range c.Fields() {
+		if env, ok := os.LookupEnv(envPrefix + strings.ToUpper(name)); ok {
+			*value = env
+		}
+	}
+}
+
+// Validate checks the config and reports every invalid setting.
+func (c *ServerConfig) Validate() error {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterValidation("listen_addr", func(fl validator.FieldLevel) bool {
+		return validListenAddr(fl.Field().String())
+	})
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.Split(f.Tag.Get("yaml"), ",")[0]
+	})
+	err := validate.Struct(c)
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	var msgs []string
+	for _, e := range verrs {
+		field := strings.TrimPrefix(e.Namespace(), "ServerConfig.")
+		switch e.Tag() {
+		case "required", "required_with":
+			msgs = append(msgs, fmt.Sprintf("%s: is required", field))
+		case "file":
+			msgs = append(msgs, fmt.Sprintf("%s: file %q does not exist", field, e.Value()))
+		case "dir":
+			msgs = append(msgs, fmt.Sprintf("%s: directory %q does not exist", field, e.Value()))
+		case "excluded_without":
+			msgs = append(msgs, fmt.Sprintf("%s: requires tls.cert", field))
+		case "unique":
+			msgs = append(msgs, fmt.Sprintf("%s: identities must be unique", field))
+		case "min":
+			msgs = append(msgs, fmt.Sprintf("%s: must be at least %s characters", field, e.Param()))
+		case "listen_addr":
+			msgs = append(msgs, fmt.Sprintf("%s: %q is not a host:port", field, e.Value()))
+		default:
+			msgs = append(msgs, fmt.Sprintf("%s: %q failed %s", field, e.Value(), e.Tag()))
+		}
+	}
+	return fmt.Errorf("invalid server config:\n  %s", strings.Join(msgs, "\n  "))
+}
+
+// validListenAddr reports whether addr is a host:port accepted by net.Listen.
+// Unlike the hostname_port tag it allows IPv6 literals such as "[::]:12345"
+// and an empty host.
+func validListenAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
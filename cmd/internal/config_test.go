@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// localPaths points the radvd paths of the config at a temporary directory,
+// so that Validate does not depend on radvd being installed.
+func localPaths(t *testing.T, config *ServerConfig) *ServerConfig {
+	t.Helper()
+	dir := t.TempDir()
+	config.Paths.Radvd = filepath.Join(dir, "radvd")
+	if err := os.WriteFile(config.Paths.Radvd, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config.Paths.ConfDir = dir
+	config.Paths.PIDDir = dir
+	return config
+}
+
+func TestDefaultServerConfigValid(t *testing.T) {
+	if err := localPaths(t, DefaultServerConfig()).Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+}
+
+func TestExampleServerConfigValid(t *testing.T) {
+	config, err := LoadServerConfig("../../server.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := localPaths(t, config).Validate(); err != nil {
+		t.Fatalf("server.example.yaml is invalid: %v", err)
+	}
+}
+
+func TestServerConfigListen(t *testing.T) {
+	for listen, ok := range map[string]bool{
+		"[::]:12345":       true,
+		"[::]:8080":        true,
+		"[2001:db8::1]:80": true,
+		"0.0.0.0:443":      true,
+		":12345":           true,
+		"localhost:12345":  true,
+		"":                 false,
+		"[::]":             false,
+		"::1:80":           false,
+		"[::]:0":           false,
+		"[::]:65536":       false,
+		"[::]:http":        false,
+	} {
+		config := localPaths(t, DefaultServerConfig())
+		config.Listen = listen
+		if err := config.Validate(); (err == nil) != ok {
+			t.Errorf("listen %q: err = %v, want valid = %v", listen, err, ok)
+		}
+	}
+}
+
+func TestServerConfigEnv(t *testing.T) {
+	t.Setenv("RADVD_MANAGER_LISTEN", "[::1]:9000")
+	config := DefaultServerConfig()
+	config.ApplyEnv()
+	if config.Listen != "[::1]:9000" {
+		t.Fatalf("listen = %q, want [::1]:9000", config.Listen)
+	}
+}
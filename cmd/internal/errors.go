@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error is a single error reported to the client, in the RESTCONF (RFC 8040) error format.
+type Error struct {
+	Type    string `json:"error-type"`
+	Tag     string `json:"error-tag"`
+	Path    string `json:"error-path,omitempty"`
+	Message string `json:"error-message,omitempty"`
+}
+
+type errorBody struct {
+	Errors struct {
+		Error []Error `json:"error"`
+	} `json:"ietf-restconf:errors"`
+}
+
+// writeErrors responds with the status code and the errors as body.
+// The Content-Type defaults to application/json unless already set.
+func writeErrors(w http.ResponseWriter, status int, errs ...Error) {
+	var body errorBody
+	body.Errors.Error = errs
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Change is a single operation needed to bring a router in line with the policy.
+type Change struct {
+	Action string          `json:"action"`
+	Server string          `json:"server"`
+	ID     uint32          `json:"id"`
+	Diff   []Diff          `json:"diff"`
+	Local  *radvd.Instance `json:"-"`
+	Remote *radvd.Instance `json:"-"`
+}
+
+// Diff is a field-level difference between the local and the remote instance.
+// Scalar fields use Old/New, list fields use Added/Removed.
+type Diff struct {
+	Field   string   `json:"field"`
+	Old     string   `json:"old,omitempty"`
+	New     string   `json:"new,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Plan compares the instances expected on this router with the remote
+// instances fetched by GetInstances and returns the changes to apply.
+// The default instance (id: 0) is never touched.
+func (c *RadvdManagerClient) Plan(instances []*radvd.Instance) []Change {
+	remote := make(map[uint32]*radvd.Instance)
+	for _, i := range c.RemoteInstances {
+		if i.ID != 0 {
+			remote[i.ID] = i
+		}
+	}
+	local := make(map[uint32]*radvd.Instance)
+	for _, i := range instances {
+		if i.RouterID == c.Server {
+			local[i.ID] = i
+		}
+	}
+
+	var changes []Change
+	for id, l := range local {
+		r, ok := remote[id]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Action: ActionCreate, Server: c.Server, ID: id, Diff: DiffInstance(l, nil), Local: l})
+		case !l.Equal(r):
+			changes = append(changes, Change{Action: ActionUpdate, Server: c.Server, ID: id, Diff: DiffInstance(l, r), Local: l, Remote: r})
+		}
+	}
+	for id, r := range remote {
+		if _, ok := local[id]; !ok {
+			changes = append(changes, Change{Action: ActionDelete, Server: c.Server, ID: id, Diff: DiffInstance(nil, r), Remote: r})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ID < changes[j].ID
+	})
+
+	return changes
+}
+
+// Apply executes a single change against the router.
+func (c *RadvdManagerClient) Apply(change Change) error {
+	switch change.Action {
+	case ActionCreate:
+		return c.CreateInstance(int(change.ID), change.Local)
+	case ActionUpdate:
+		return c.UpdateInstance(int(change.ID), change.Local)
+	case ActionDelete:
+		return c.DeleteInstance(int(change.ID))
+	default:
+		return fmt.Errorf("unknown action: %s", change.Action)
+	}
+}
+
+// runtimeFields are reported by the server and never part of a diff.
+var runtimeFields = map[string]bool{
+	"id":          true,
+	"pid":         true,
+	"state":       true,
+	"restarts":    true,
+	"last_exit":   true,
+	"last_stderr": true,
+}
+
+// DiffInstance returns the field-level differences needed to turn remote into local.
+// A nil instance is treated as an empty one. Fields are named after their JSON keys,
+// and list elements are matched by their first field (route, prefix, address, ...).
+func DiffInstance(local, remote *radvd.Instance) []Diff {
+	var l, r radvd.Instance
+	if local != nil {
+		l = *local
+	}
+	if remote != nil {
+		r = *remote
+	}
+	lv, rv := reflect.ValueOf(l), reflect.ValueOf(r)
+	t := lv.Type()
+
+	var diffs []Diff
+	for n := 0; n < t.NumField(); n++ {
+		field := strings.Split(t.Field(n).Tag.Get("json"), ",")[0]
+		if field == "" || field == "-" || runtimeFields[field] {
+			continue
+		}
+		lf, rf := lv.Field(n), rv.Field(n)
+		if lf.Kind() != reflect.Slice {
+			if !reflect.DeepEqual(lf.Interface(), rf.Interface()) {
+				diffs = append(diffs, Diff{Field: field, Old: formatValue(rf), New: formatValue(lf)})
+			}
+			continue
+		}
+		lm, rm := keyElements(lf), keyElements(rf)
+		var added, removed []string
+		for _, k := range sortedKeys(lm) {
+			rs, ok := rm[k]
+			switch {
+			case !ok:
+				added = append(added, lm[k])
+			case rs != lm[k]:
+				diffs = append(diffs, Diff{Field: field + "[" + k + "]", Old: rs, New: lm[k]})
+			}
+		}
+		for _, k := range sortedKeys(rm) {
+			if _, ok := lm[k]; !ok {
+				removed = append(removed, rm[k])
+			}
+		}
+		if len(added) > 0 || len(removed) > 0 {
+			diffs = append(diffs, Diff{Field: field, Added: added, Removed: removed})
+		}
+	}
+
+	return diffs
+}
+
+// keyElements maps each element of a slice to its string representation,
+// keyed by the element itself or by the first field of a struct element.
+func keyElements(v reflect.Value) map[string]string {
+	m := make(map[string]string)
+	for n := 0; n < v.Len(); n++ {
+		e := v.Index(n)
+		key := fmt.Sprint(e.Interface())
+		if e.Kind() == reflect.Struct {
+			key = fmt.Sprint(e.Field(0).Interface())
+		}
+		m[key] = formatValue(e)
+	}
+	return m
+}
+
+// formatValue formats a field for a diff. Unset optional fields are shown as "default".
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "default"
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Sprint(v.Interface())
+	}
+	t := v.Type()
+	var fields []string
+	for n := 0; n < t.NumField(); n++ {
+		name, opts, _ := strings.Cut(t.Field(n).Tag.Get("json"), ",")
+		if opts == "omitempty" && v.Field(n).IsZero() {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%s=%s", name, formatValue(v.Field(n))))
+	}
+	return strings.Join(fields, " ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
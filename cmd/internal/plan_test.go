@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+func TestDiffInstance(t *testing.T) {
+	route := func(prefix string) radvd.Route {
+		return radvd.Route{Route: prefix, AdvRouteLifetime: 1800, AdvRoutePreference: "medium"}
+	}
+	for _, c := range []struct {
+		name   string
+		change func(i *radvd.Instance)
+		want   []Diff
+	}{
+		{
+			name:   "unchanged",
+			change: func(i *radvd.Instance) {},
+		},
+		{
+			name: "route added",
+			change: func(i *radvd.Instance) {
+				i.Routes = append(i.Routes, route("2001:db8:2::/64"))
+			},
+			want: []Diff{{Field: "routes", Added: []string{"route=2001:db8:2::/64 adv_route_lifetime=1800 adv_route_preference=medium"}}},
+		},
+		{
+			name: "route removed",
+			change: func(i *radvd.Instance) {
+				i.Routes = nil
+			},
+			want: []Diff{{Field: "routes", Removed: []string{"route=2001:db8:1::/64 adv_route_lifetime=1800 adv_route_preference=medium"}}},
+		},
+		{
+			name: "route changed",
+			change: func(i *radvd.Instance) {
+				i.Routes[0].AdvRoutePreference = "high"
+			},
+			want: []Diff{{
+				Field: "routes[2001:db8:1::/64]",
+				Old:   "route=2001:db8:1::/64 adv_route_lifetime=1800 adv_route_preference=medium",
+				New:   "route=2001:db8:1::/64 adv_route_lifetime=1800 adv_route_preference=high",
+			}},
+		},
+		{
+			name: "default preference",
+			change: func(i *radvd.Instance) {
+				i.AdvDefaultPreference = "high"
+			},
+			want: []Diff{{Field: "adv_default_preference", Old: "medium", New: "high"}},
+		},
+		{
+			name: "clients",
+			change: func(i *radvd.Instance) {
+				i.Clients = []string{"fe80::2", "fe80::3"}
+			},
+			want: []Diff{{Field: "clients", Added: []string{"fe80::3"}, Removed: []string{"fe80::1"}}},
+		},
+		{
+			name: "optional field set",
+			change: func(i *radvd.Instance) {
+				mtu := uint32(1500)
+				i.AdvLinkMTU = &mtu
+			},
+			want: []Diff{{Field: "adv_link_mtu", Old: "default", New: "1500"}},
+		},
+		{
+			name: "runtime fields",
+			change: func(i *radvd.Instance) {
+				i.PID = 1234
+				i.State = radvd.StateRunning
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			remote := testInstance(1)
+			remote.AdvDefaultPreference = "medium"
+			remote.Routes = []radvd.Route{route("2001:db8:1::/64")}
+			remote.Clients = []string{"fe80::1", "fe80::2"}
+			local := remote.Clone()
+			c.change(local)
+			if got := DiffInstance(local, remote); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("DiffInstance = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	c := &RadvdManagerClient{Server: "fc00:abcd::a"}
+	remote := []*radvd.Instance{testInstance(0), testInstance(1), testInstance(3)}
+	c.RemoteInstances = remote
+	local := []*radvd.Instance{testInstance(1), testInstance(2), testInstance(4)}
+	local[0].AdvDefaultLifetime = 600
+	local[2].RouterID = "fc00:abcd::b"
+	for _, i := range local[:2] {
+		i.RouterID = c.Server
+	}
+	remote[1].RouterID = c.Server
+
+	changes := c.Plan(local)
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.Action)
+	}
+	// instance 0 is never deleted, instance 4 belongs to another router
+	if want := []string{ActionUpdate, ActionCreate, ActionDelete}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("actions = %v, want %v", got, want)
+	}
+
+	data, err := json.Marshal(changes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"action":"update","server":"fc00:abcd::a","id":1,"diff":[{"field":"adv_default_lifetime","old":"0","new":"600"}]}`
+	if string(data) != want {
+		t.Fatalf("JSON = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"sort"
+	"sync"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+// Registry holds the radvd instances managed by the server, keyed by instance ID.
+// Instances are stored and returned as copies, so callers never share them.
+// Start/reload/stop of a single instance must be serialized with Lock.
+type Registry struct {
+	mu        sync.RWMutex
+	instances map[uint32]*radvd.Instance
+	locks     map[uint32]*sync.Mutex
+}
+
+func NewRegistry(instances []*radvd.Instance) *Registry {
+	r := &Registry{
+		instances: make(map[uint32]*radvd.Instance),
+		locks:     make(map[uint32]*sync.Mutex),
+	}
+	for _, i := range instances {
+		r.instances[i.ID] = i.Clone()
+	}
+	return r
+}
+
+// Lock serializes operations on the instance with the given ID and returns
+// the function to release it. Operations on different IDs run in parallel.
+func (r *Registry) Lock(id uint32) func() {
+	r.mu.Lock()
+	l, ok := r.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		r.locks[id] = l
+	}
+	r.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// Get returns a copy of the instance with the given ID.
+func (r *Registry) Get(id uint32) (*radvd.Instance, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i, ok := r.instances[id]
+	if !ok {
+		return nil, false
+	}
+	return i.Clone(), true
+}
+
+// Put stores a copy of the instance, replacing any instance with the same ID.
+func (r *Registry) Put(instance *radvd.Instance) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.instances[instance.ID] = instance.Clone()
+}
+
+func (r *Registry) Delete(id uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.instances, id)
+}
+
+// Snapshot returns copies of all instances sorted by ID.
+func (r *Registry) Snapshot() []*radvd.Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	instances := make([]*radvd.Instance, 0, len(r.instances))
+	for _, i := range r.instances {
+		instances = append(instances, i.Clone())
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+// send is do for other goroutines, where t.Fatal must not be called.
+func send(ts *httptest.Server, method string, i *radvd.Instance) (int, error) {
+	path := fmt.Sprintf("%s/rest/data/radvd:instances/%d", ts.URL, i.ID)
+	data, err := json.Marshal(i)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(method, path, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestRegistryParallelCreate(t *testing.T) {
+	ts, _, exec, _ := newTestServer(t, ServerOptions{})
+	const requests = 20
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := send(ts, "POST", testInstance(1))
+			if err != nil {
+				t.Error(err)
+			}
+			statuses <- status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	created := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("POST: status %d", status)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d POSTs created the instance, want 1", created)
+	}
+	if running := exec.Running(); len(running) != 1 {
+		t.Fatalf("running radvd: %v, want one", running)
+	}
+}
+
+func TestRegistryLockPerID(t *testing.T) {
+	manager, _, _ := radvd.NewFakeManager()
+	srv := NewServer("", nil, slog.New(slog.NewTextHandler(io.Discard, nil)), ServerOptions{Manager: manager})
+	ts := httptest.NewServer(srv.Handler)
+	defer ts.Close()
+
+	// an operation on instance 1 is in progress
+	unlock := srv.instances.Lock(1)
+
+	// a request for another instance is not blocked by it
+	created := make(chan int, 1)
+	go func() {
+		status, err := send(ts, "POST", testInstance(2))
+		if err != nil {
+			t.Error(err)
+		}
+		created <- status
+	}()
+	select {
+	case status := <-created:
+		if status != http.StatusCreated {
+			t.Fatalf("POST of instance 2: status %d", status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("POST of instance 2 is blocked by instance 1")
+	}
+
+	// a request for the same instance waits for it
+	replaced := make(chan int, 1)
+	go func() {
+		status, err := send(ts, "PUT", testInstance(1))
+		if err != nil {
+			t.Error(err)
+		}
+		replaced <- status
+	}()
+	select {
+	case status := <-replaced:
+		t.Fatalf("PUT of instance 1 did not wait for the lock: status %d", status)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if status := <-replaced; status != http.StatusCreated {
+		t.Fatalf("PUT of instance 1: status %d", status)
+	}
+}
@@ -0,0 +1,517 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+// RESTCONF (RFC 8040) API, served next to the plain REST API.
+const (
+	mediaTypeYangJSON  = "application/yang-data+json"
+	restconfRoot       = "/restconf"
+	pathRestconfData   = restconfRoot + "/data"
+	pathRestconfList   = pathRestconfData + "/radvd:instances"
+	pathRestconfEntry  = pathRestconfList + "/instance={instance}"
+	yangLibraryVersion = "2019-01-04"
+)
+
+func (s *RadvdManagerServer) registerRestconf(router *mux.Router) {
+	router.HandleFunc("/.well-known/host-meta", s.handleHostMeta).Methods("GET", "HEAD")
+	router.HandleFunc(restconfRoot, s.handleRestconfRoot).Methods("GET", "HEAD")
+	router.HandleFunc(pathRestconfData, s.handleRestconfInstances).Methods("GET", "HEAD")
+	router.HandleFunc(pathRestconfList, s.handleRestconfInstances).Methods("GET", "HEAD", "POST", "DELETE")
+	router.HandleFunc(pathRestconfEntry, s.handleRestconfInstance).Methods("GET", "HEAD", "PUT", "DELETE")
+	for _, path := range []string{restconfRoot, pathRestconfData, pathRestconfList, pathRestconfEntry} {
+		router.HandleFunc(path, s.handleRestconfOptions).Methods("OPTIONS")
+	}
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, restconfRoot) {
+			http.NotFound(w, r)
+			return
+		}
+		writeRestconfError(w, http.StatusNotFound, "invalid-value", r.URL.Path, "resource not found")
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeRestconfError(w, http.StatusMethodNotAllowed, "operation-not-supported", r.URL.Path, r.Method+" is not supported")
+	})
+}
+
+// [GET] /.well-known/host-meta
+func (s *RadvdManagerServer) handleHostMeta(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/xrd+xml")
+	fmt.Fprintf(w, "<XRD xmlns='http://docs.oasis-open.org/ns/xri/xrd-1.0'>\n  <Link rel='restconf' href='%s'/>\n</XRD>\n", restconfRoot)
+}
+
+// [GET] /restconf
+func (s *RadvdManagerServer) handleRestconfRoot(w http.ResponseWriter, r *http.Request) {
+	writeYangJSON(w, http.StatusOK, map[string]any{
+		"ietf-restconf:restconf": map[string]any{
+			"data":                 map[string]any{},
+			"operations":           map[string]any{},
+			"yang-library-version": yangLibraryVersion,
+		},
+	})
+}
+
+// [OPTIONS] /restconf/...
+func (s *RadvdManagerServer) handleRestconfOptions(w http.ResponseWriter, r *http.Request) {
+	allow := "GET, HEAD, OPTIONS"
+	switch {
+	case strings.HasPrefix(r.URL.Path, pathRestconfList+"/instance="):
+		allow = "GET, HEAD, PUT, DELETE, OPTIONS"
+	case r.URL.Path == pathRestconfList:
+		allow = "GET, HEAD, POST, DELETE, OPTIONS"
+	}
+	w.Header().Set("Allow", allow)
+	w.WriteHeader(http.StatusOK)
+}
+
+// [GET|POST|DELETE] /restconf/data/radvd:instances
+func (s *RadvdManagerServer) handleRestconfInstances(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		s.logger.Info("[GET]", "from", r.RemoteAddr, "identity", identityOf(r), "api", "restconf")
+		if !acceptsYangJSON(r) {
+			writeRestconfError(w, http.StatusNotAcceptable, "invalid-value", r.URL.Path, "only "+mediaTypeYangJSON+" is supported")
+			return
+		}
+		instances := []any{}
+		for _, i := range s.instances.Snapshot() {
+			if !s.visible(r, i.ID) {
+				continue
+			}
+			s.annotate(i)
+			data, err := instanceYangData(i)
+			if err != nil {
+				writeRestconfError(w, http.StatusInternalServerError, "operation-failed", r.URL.Path, err.Error())
+				return
+			}
+			instances = append(instances, data)
+		}
+		content, rerr := applyQuery(r, map[string]any{"instance": instances})
+		if rerr != nil {
+			writeRestconfErrors(w, http.StatusBadRequest, *rerr)
+			return
+		}
+		writeYangJSON(w, http.StatusOK, map[string]any{"radvd:instances": content})
+	case "POST":
+		s.logger.Info("[POST]", "from", r.RemoteAddr, "identity", identityOf(r), "api", "restconf")
+		new, ok := s.decodeRestconfInstance(w, r)
+		if !ok {
+			return
+		}
+		if new.ID == 0 {
+			writeRestconfError(w, http.StatusForbidden, "access-denied", r.URL.Path, "the default instance (id: 0) is read-only")
+			return
+		}
+		if s.authz != nil && !s.authz.Allowed(identityOf(r), http.MethodPost, int(new.ID)) {
+			writeRestconfError(w, http.StatusForbidden, "access-denied", r.URL.Path, fmt.Sprintf("%s is not allowed to POST instance %d", identityOf(r), new.ID))
+			return
+		}
+		if err := s.createInstance(new); err != nil {
+			writeRestconfError(w, err.status, err.tag, restconfEntryPath(new.ID), err.Error())
+			return
+		}
+		w.Header().Set("Location", restconfEntryPath(new.ID))
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		s.logger.Info("[DELETE]", "from", r.RemoteAddr, "identity", identityOf(r), "api", "restconf")
+		for _, i := range s.instances.Snapshot() {
+			if i.ID == 0 {
+				continue
+			}
+			if err := s.deleteInstance(i.ID); err != nil {
+				s.logger.Error("Failed to stop radvd", "error", err.Error())
+				writeRestconfError(w, http.StatusInternalServerError, "operation-failed", restconfEntryPath(i.ID), err.Error())
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// [GET|PUT|DELETE] /restconf/data/radvd:instances/instance={instance}
+func (s *RadvdManagerServer) handleRestconfInstance(w http.ResponseWriter, r *http.Request) {
+	instanceStr := mux.Vars(r)["instance"]
+	instance, err := strconv.ParseUint(instanceStr, 10, 32)
+	if err != nil {
+		writeRestconfError(w, http.StatusBadRequest, "invalid-value", r.URL.Path, "invalid instance ID: "+instanceStr)
+		return
+	}
+	id := uint32(instance)
+	switch r.Method {
+	case "GET", "HEAD":
+		s.logger.Info("[GET]", "from", r.RemoteAddr, "identity", identityOf(r), "api", "restconf")
+		if !acceptsYangJSON(r) {
+			writeRestconfError(w, http.StatusNotAcceptable, "invalid-value", r.URL.Path, "only "+mediaTypeYangJSON+" is supported")
+			return
+		}
+		i, ok := s.instances.Get(id)
+		if !ok {
+			writeRestconfError(w, http.StatusNotFound, "invalid-value", r.URL.Path, fmt.Sprintf("instance %d does not exist", id))
+			return
+		}
+		s.annotate(i)
+		content, err := instanceYangData(i)
+		if err != nil {
+			writeRestconfError(w, http.StatusInternalServerError, "operation-failed", r.URL.Path, err.Error())
+			return
+		}
+		content, rerr := applyQuery(r, content)
+		if rerr != nil {
+			writeRestconfErrors(w, http.StatusBadRequest, *rerr)
+			return
+		}
+		writeYangJSON(w, http.StatusOK, map[string]any{"radvd:instance": []any{content}})
+	case "PUT":
+		s.logger.Info("[PUT]", "from", r.RemoteAddr, "identity", identityOf(r), "api", "restconf")
+		new, ok := s.decodeRestconfInstance(w, r)
+		if !ok {
+			return
+		}
+		if new.ID != id {
+			writeRestconfError(w, http.StatusBadRequest, "invalid-value", r.URL.Path, fmt.Sprintf("key in body (%d) does not match the target resource (%d)", new.ID, id))
+			return
+		}
+		created, err := s.replaceInstance(new)
+		if err != nil {
+			writeRestconfError(w, err.status, err.tag, r.URL.Path, err.Error())
+			return
+		}
+		if created {
+			w.Header().Set("Location", restconfEntryPath(id))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		s.logger.Info("[DELETE]", "from", r.RemoteAddr, "identity", identityOf(r), "api", "restconf")
+		if _, ok := s.instances.Get(id); !ok {
+			writeRestconfError(w, http.StatusNotFound, "invalid-value", r.URL.Path, fmt.Sprintf("instance %d does not exist", id))
+			return
+		}
+		if err := s.deleteInstance(id); err != nil {
+			s.logger.Error("Failed to stop radvd", "error", err.Error())
+			writeRestconfError(w, http.StatusInternalServerError, "operation-failed", r.URL.Path, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// decodeRestconfInstance reads a "radvd:instance" request body. The list entry
+// may be given as an object or as an array with a single entry.
+func (s *RadvdManagerServer) decodeRestconfInstance(w http.ResponseWriter, r *http.Request) (*radvd.Instance, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mediaTypeYangJSON && mediaType != "application/json" {
+		writeRestconfError(w, http.StatusUnsupportedMediaType, "invalid-value", r.URL.Path, "request body must be "+mediaTypeYangJSON)
+		return nil, false
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRestconfError(w, http.StatusBadRequest, "malformed-message", r.URL.Path, err.Error())
+		return nil, false
+	}
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(body, &wrapper); err != nil {
+		writeRestconfError(w, http.StatusBadRequest, "malformed-message", r.URL.Path, err.Error())
+		return nil, false
+	}
+	entry, ok := wrapper["radvd:instance"]
+	if !ok || len(wrapper) != 1 {
+		writeRestconfError(w, http.StatusBadRequest, "malformed-message", r.URL.Path, `request body must contain exactly one "radvd:instance"`)
+		return nil, false
+	}
+	if trimmed := bytes.TrimSpace(entry); len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []json.RawMessage
+		if err := json.Unmarshal(trimmed, &entries); err != nil || len(entries) != 1 {
+			writeRestconfError(w, http.StatusBadRequest, "malformed-message", r.URL.Path, `"radvd:instance" must contain exactly one entry`)
+			return nil, false
+		}
+		entry = entries[0]
+	}
+	// decimal64 values are strings in RFC 7951
+	entry, err = radvd.DecodeInstanceYangJSON(entry)
+	if err != nil {
+		writeRestconfError(w, http.StatusBadRequest, "malformed-message", r.URL.Path, err.Error())
+		return nil, false
+	}
+	new, errs := s.parseInstance(entry)
+	if errs != nil {
+		writeRestconfErrors(w, http.StatusBadRequest, errs...)
+		return nil, false
+	}
+	return new, true
+}
+
+func restconfEntryPath(id uint32) string {
+	return pathRestconfList + "/instance=" + strconv.Itoa(int(id))
+}
+
+func acceptsYangJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+	for _, a := range strings.Split(accept, ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(a))
+		switch mediaType {
+		case mediaTypeYangJSON, "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+func writeYangJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", mediaTypeYangJSON)
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeRestconfError(w http.ResponseWriter, status int, tag string, path string, message string) {
+	errType := "protocol"
+	if tag == "invalid-value" || tag == "data-exists" || tag == "operation-failed" {
+		errType = "application"
+	}
+	writeRestconfErrors(w, status, Error{Type: errType, Tag: tag, Path: path, Message: message})
+}
+
+func writeRestconfErrors(w http.ResponseWriter, status int, errs ...Error) {
+	w.Header().Set("Content-Type", mediaTypeYangJSON)
+	writeErrors(w, status, errs...)
+}
+
+// toYangData converts a value into its generic JSON representation.
+func toYangData(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&out); err != nil {
+		return nil, err
+	}
+	return dropNull(out), nil
+}
+
+// instanceYangData converts an instance into its RFC 7951 representation.
+func instanceYangData(i *radvd.Instance) (any, error) {
+	data, err := toYangData(i)
+	if err != nil {
+		return nil, err
+	}
+	return radvd.EncodeInstanceYangJSON(data)
+}
+
+// dropNull removes null values, which have no encoding in YANG data (RFC 7951).
+func dropNull(v any) any {
+	switch v := v.(type) {
+	case []any:
+		for n, e := range v {
+			v[n] = dropNull(e)
+		}
+	case map[string]any:
+		for name, value := range v {
+			if value == nil {
+				delete(v, name)
+				continue
+			}
+			v[name] = dropNull(value)
+		}
+	}
+	return v
+}
+
+// applyQuery applies the "fields" and "depth" query parameters (RFC 8040 4.8) to the content.
+func applyQuery(r *http.Request, content any) (any, *Error) {
+	query, err := restconfQuery(r.URL.RawQuery)
+	if err != nil {
+		return nil, &Error{Type: "protocol", Tag: "invalid-value", Path: r.URL.Path, Message: err.Error()}
+	}
+	for name := range query {
+		if name != "depth" && name != "fields" {
+			return nil, &Error{Type: "protocol", Tag: "unknown-attribute", Path: r.URL.Path, Message: "unsupported query parameter: " + name}
+		}
+	}
+	if fields := query.Get("fields"); fields != "" {
+		tree, err := parseFields(fields)
+		if err != nil {
+			return nil, &Error{Type: "protocol", Tag: "invalid-value", Path: r.URL.Path, Message: err.Error()}
+		}
+		content = selectFields(content, tree)
+	}
+	if depth := query.Get("depth"); depth != "" && depth != "unbounded" {
+		n, err := strconv.Atoi(depth)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, &Error{Type: "protocol", Tag: "invalid-value", Path: r.URL.Path, Message: "depth must be 1..65535 or unbounded"}
+		}
+		content = limitDepth(content, n)
+	}
+	return content, nil
+}
+
+// restconfQuery parses the query string. url.ParseQuery can not be used
+// because ";" separates the nodes of the "fields" parameter.
+func restconfQuery(raw string) (url.Values, error) {
+	query := url.Values{}
+	for _, param := range strings.Split(raw, "&") {
+		if param == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query parameter: %w", err)
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query parameter %s: %w", name, err)
+		}
+		if query.Has(name) {
+			return nil, fmt.Errorf("query parameter %s must not be repeated", name)
+		}
+		query.Set(name, value)
+	}
+	return query, nil
+}
+
+// fieldTree is a parsed "fields" expression. A nil subtree selects the whole node.
+type fieldTree map[string]fieldTree
+
+// parseFields parses a fields expression such as "name;routes(route;adv_route_preference)".
+func parseFields(expr string) (fieldTree, error) {
+	tree, rest, err := parseFieldList(expr)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid fields expression: unexpected %q", rest)
+	}
+	return tree, nil
+}
+
+func parseFieldList(expr string) (fieldTree, string, error) {
+	tree := fieldTree{}
+	for {
+		end := strings.IndexAny(expr, ";()")
+		if end < 0 {
+			end = len(expr)
+		}
+		path := expr[:end]
+		if path == "" {
+			return nil, "", fmt.Errorf("invalid fields expression: empty node name")
+		}
+		// "a/b/c" selects c below b below a
+		nodes := strings.Split(path, "/")
+		leaf := tree
+		for _, n := range nodes[:len(nodes)-1] {
+			if leaf[n] == nil {
+				leaf[n] = fieldTree{}
+			}
+			leaf = leaf[n]
+		}
+		last := nodes[len(nodes)-1]
+		expr = expr[end:]
+		if strings.HasPrefix(expr, "(") {
+			sub, rest, err := parseFieldList(expr[1:])
+			if err != nil {
+				return nil, "", err
+			}
+			if !strings.HasPrefix(rest, ")") {
+				return nil, "", fmt.Errorf("invalid fields expression: missing )")
+			}
+			leaf[last] = sub
+			expr = rest[1:]
+		} else if _, ok := leaf[last]; !ok {
+			leaf[last] = nil
+		}
+		if !strings.HasPrefix(expr, ";") {
+			return tree, expr, nil
+		}
+		expr = expr[1:]
+	}
+}
+
+func selectFields(v any, tree fieldTree) any {
+	switch v := v.(type) {
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, e := range v {
+			out = append(out, selectFields(e, tree))
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any)
+		for name, sub := range tree {
+			value, ok := v[name]
+			if !ok {
+				continue
+			}
+			if sub == nil {
+				out[name] = value
+				continue
+			}
+			out[name] = selectFields(value, sub)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// limitDepth removes the child containers and lists deeper than depth.
+// Leafs and leaf-lists of the last level are kept.
+func limitDepth(v any, depth int) any {
+	switch v := v.(type) {
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, e := range v {
+			out = append(out, limitDepth(e, depth))
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any)
+		for name, value := range v {
+			if isLeafValue(value) {
+				out[name] = value
+				continue
+			}
+			if depth > 1 {
+				out[name] = limitDepth(value, depth-1)
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func isLeafValue(v any) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		return false
+	case []any:
+		for _, e := range v {
+			if _, ok := e.(map[string]any); ok {
+				return false
+			}
+		}
+	}
+	return true
+}
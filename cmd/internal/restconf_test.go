@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func doRestconf(t *testing.T, ts *httptest.Server, method, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", mediaTypeYangJSON)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decimal64 leaves are strings in RFC 7951
+func TestRestconfDecimal64(t *testing.T) {
+	ts, _, _, _ := newTestServer(t, ServerOptions{})
+	body := `{"radvd:instance": [{"id": 1, "name": "eth1", "adv_send_advert": true, "min_delay_between_ras": "0.5"}]}`
+	if resp := doRestconf(t, ts, "POST", ts.URL+pathRestconfList, body); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: %s", resp.Status)
+	}
+	resp := doRestconf(t, ts, "GET", ts.URL+restconfEntryPath(1)+"?fields=min_delay_between_ras", "")
+	var got struct {
+		Instance []map[string]any `json:"radvd:instance"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Instance) != 1 || got.Instance[0]["min_delay_between_ras"] != "0.5" {
+		t.Fatalf("GET: %v", got.Instance)
+	}
+
+	// the plain REST API keeps numbers
+	var i map[string]any
+	json.NewDecoder(do(t, ts, "GET", "/rest/data/radvd:instances/1", nil).Body).Decode(&i)
+	if i["min_delay_between_ras"] != 0.5 {
+		t.Fatalf("REST GET: min_delay_between_ras = %#v", i["min_delay_between_ras"])
+	}
+}
+
+func TestRestconfStatusCodes(t *testing.T) {
+	ts, _, _, _ := newTestServer(t, ServerOptions{})
+	entry := func(id int, name string) string {
+		return `{"radvd:instance": [{"id": ` + strconv.Itoa(id) + `, "name": "` + name + `", "adv_send_advert": true}]}`
+	}
+	for _, c := range []struct {
+		method string
+		path   string
+		body   string
+		header map[string]string
+		status int
+		tag    string
+	}{
+		{"GET", "/.well-known/host-meta", "", nil, http.StatusOK, ""},
+		{"GET", restconfRoot, "", nil, http.StatusOK, ""},
+		{"GET", pathRestconfList, "", nil, http.StatusOK, ""},
+		{"GET", pathRestconfList, "", map[string]string{"Accept": "application/xml"}, http.StatusNotAcceptable, "invalid-value"},
+		{"POST", pathRestconfList, entry(1, "eth1"), nil, http.StatusCreated, ""},
+		{"POST", pathRestconfList, entry(1, "eth1"), nil, http.StatusConflict, "data-exists"},
+		{"POST", pathRestconfList, entry(0, "eth0"), nil, http.StatusForbidden, "access-denied"},
+		{"POST", pathRestconfList, entry(2, "eth1"), map[string]string{"Content-Type": "application/xml"}, http.StatusUnsupportedMediaType, "invalid-value"},
+		{"POST", pathRestconfList, `{"radvd:instance": [{"id": 2}]}`, nil, http.StatusBadRequest, "missing-element"},
+		{"POST", pathRestconfList, `{"radvd:instance": [{"id": 2, "name": "eth1", "foo": 1}]}`, nil, http.StatusBadRequest, "unknown-element"},
+		{"POST", pathRestconfList, `{"radvd:instance": `, nil, http.StatusBadRequest, "malformed-message"},
+		{"GET", restconfEntryPath(1), "", nil, http.StatusOK, ""},
+		{"HEAD", restconfEntryPath(1), "", nil, http.StatusOK, ""},
+		{"GET", restconfEntryPath(1) + "?depth=0", "", nil, http.StatusBadRequest, "invalid-value"},
+		{"GET", restconfEntryPath(1) + "?foo=1", "", nil, http.StatusBadRequest, "unknown-attribute"},
+		{"GET", restconfEntryPath(9), "", nil, http.StatusNotFound, "invalid-value"},
+		{"GET", pathRestconfList + "/instance=x", "", nil, http.StatusBadRequest, "invalid-value"},
+		{"PUT", restconfEntryPath(1), entry(2, "eth1"), nil, http.StatusBadRequest, "invalid-value"},
+		{"PUT", restconfEntryPath(1), entry(1, "eth2"), nil, http.StatusNoContent, ""},
+		{"PUT", restconfEntryPath(2), entry(2, "eth2"), nil, http.StatusCreated, ""},
+		{"PATCH", restconfEntryPath(2), entry(2, "eth2"), nil, http.StatusMethodNotAllowed, "operation-not-supported"},
+		{"OPTIONS", restconfEntryPath(2), "", nil, http.StatusOK, ""},
+		{"DELETE", restconfEntryPath(2), "", nil, http.StatusNoContent, ""},
+		{"DELETE", restconfEntryPath(2), "", nil, http.StatusNotFound, "invalid-value"},
+		{"GET", restconfRoot + "/foo", "", nil, http.StatusNotFound, "invalid-value"},
+		{"DELETE", pathRestconfList, "", nil, http.StatusNoContent, ""},
+	} {
+		req, err := http.NewRequest(c.method, ts.URL+c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.body != "" {
+			req.Header.Set("Content-Type", mediaTypeYangJSON)
+		}
+		for name, value := range c.header {
+			req.Header.Set(name, value)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body errorBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("%s %s: %s, want %d (%+v)", c.method, c.path, resp.Status, c.status, body.Errors.Error)
+			continue
+		}
+		if c.tag == "" {
+			continue
+		}
+		if len(body.Errors.Error) == 0 || body.Errors.Error[0].Tag != c.tag {
+			t.Errorf("%s %s: errors %+v, want tag %s", c.method, c.path, body.Errors.Error, c.tag)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != mediaTypeYangJSON {
+			t.Errorf("%s %s: Content-Type %q", c.method, c.path, ct)
+		}
+	}
+}
@@ -2,11 +2,14 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
+	"sync"
 
 	"github.com/gorilla/mux"
 
@@ -15,25 +18,63 @@ import (
 
 type RadvdManagerServer struct {
 	http.Server
-	instances []*radvd.Instance
-	logger    *slog.Logger
+	instances   *Registry
+	manager     radvd.Manager
+	logger      *slog.Logger
+	stateFile   string
+	stateMu     sync.Mutex
+	tokens      []Token
+	requireCert bool
+	authz       *AuthzPolicy
 }
 
-func NewServer(host string, instances []*radvd.Instance, logger *slog.Logger) *RadvdManagerServer {
-	if err := radvd.InitInstances(&instances); err != nil {
+type ServerOptions struct {
+	// StateFile persists the registry across restarts. On start, running radvd
+	// processes listed in the state file are adopted instead of restarted.
+	// Empty disables persistence.
+	StateFile string
+	// Manager runs radvd. Defaults to real radvd processes on the local system.
+	Manager radvd.Manager
+	// Tokens are the accepted bearer tokens. Empty disables token authentication.
+	Tokens []Token
+	// RequireClientCert rejects requests without a verified client certificate
+	// unless they carry a valid bearer token.
+	RequireClientCert bool
+	// Authz restricts the methods and instance IDs per identity. Nil allows everything.
+	Authz *AuthzPolicy
+}
+
+func NewServer(host string, instances []*radvd.Instance, logger *slog.Logger, opts ServerOptions) *RadvdManagerServer {
+	manager := opts.Manager
+	if manager == nil {
+		manager = radvd.NewManager(radvd.OSExecutor{}, radvd.OSFileSystem{}, radvd.DefaultPaths(), logger)
+	}
+	found, err := manager.Instances()
+	if err != nil {
 		logger.Error("Failed to initialize instances", "error", err.Error())
 	}
+	instances = append(instances, found...)
 	srv := &RadvdManagerServer{
-		instances: instances,
-		logger:    logger,
+		manager:     manager,
+		logger:      logger,
+		stateFile:   opts.StateFile,
+		tokens:      opts.Tokens,
+		requireCert: opts.RequireClientCert,
+		authz:       opts.Authz,
 	}
+	if srv.stateFile != "" {
+		instances = srv.restoreState(instances)
+	}
+	srv.instances = NewRegistry(instances)
 
 	router := mux.NewRouter()
+	router.Use(srv.authorize)
 	router.HandleFunc("/rest/data/radvd:instances", srv.handleInstances).Methods("GET", "DELETE")
 	router.HandleFunc("/rest/data/radvd:instances/{instance}", srv.handleInstance).Methods("GET", "POST", "PUT", "DELETE")
+	srv.registerRestconf(router)
 
 	srv.Addr = host
-	srv.Handler = router
+	srv.Handler = srv.authenticate(router)
 
 	return srv
 }
@@ -41,13 +82,16 @@ func NewServer(host string, instances []*radvd.Instance, logger *slog.Logger) *R
 func (s *RadvdManagerServer) handleInstances(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
-		s.logger.Info("[GET]", "from", r.RemoteAddr)
+		s.logger.Info("[GET]", "from", r.RemoteAddr, "identity", identityOf(r))
 		w.Header().Set("Content-Type", "application/json")
-		for _, i := range s.instances {
-			pid, _ := radvd.GetRadvdPID(int(i.ID))
-			i.PID = uint32(pid)
+		instances := []*radvd.Instance{}
+		for _, i := range s.instances.Snapshot() {
+			if s.visible(r, i.ID) {
+				s.annotate(i)
+				instances = append(instances, i)
+			}
 		}
-		if err := json.NewEncoder(w).Encode(s.instances); err != nil {
+		if err := json.NewEncoder(w).Encode(instances); err != nil {
 			s.logger.Error("Failed to encode JSON", "error", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -55,20 +99,17 @@ func (s *RadvdManagerServer) handleInstances(w http.ResponseWriter, r *http.Requ
 		w.WriteHeader(http.StatusOK)
 		return
 	case "DELETE":
-		var newInstances []*radvd.Instance
-		s.logger.Info("[DELETE]", "from", r.RemoteAddr)
-		for _, i := range s.instances {
-			if err := radvd.StopRadvd(int(i.ID)); err != nil {
+		s.logger.Info("[DELETE]", "from", r.RemoteAddr, "identity", identityOf(r))
+		for _, i := range s.instances.Snapshot() {
+			if i.ID == 0 {
+				continue
+			}
+			if err := s.deleteInstance(i.ID); err != nil {
 				s.logger.Error("Failed to stop radvd", "error", err.Error())
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
-			if i.ID != 0 {
-				newInstances = append(newInstances, i)
-			}
 		}
-		s.instances = newInstances
-		//s.instances = []*radvd.Instance{}
 		w.WriteHeader(http.StatusNoContent)
 		return
 	default:
@@ -81,74 +122,87 @@ func (s *RadvdManagerServer) handleInstances(w http.ResponseWriter, r *http.Requ
 func (s *RadvdManagerServer) handleInstance(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	instanceStr := vars["instance"]
-	instance, err := strconv.Atoi(instanceStr)
-	if err != nil && instance <= 0 {
+	id, err := strconv.ParseUint(instanceStr, 10, 32)
+	if err != nil {
 		s.logger.Error("Invalid Instance ID", "instance", instanceStr)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	instance := uint32(id)
 	switch r.Method {
 	case "GET":
-		s.logger.Info("[GET]", "from", r.RemoteAddr)
-		w.Header().Set("Content-Type", "application/json")
-		for _, i := range s.instances {
-			if i.ID == uint32(instance) {
-				pid, _ := radvd.GetRadvdPID(int(i.ID))
-				i.PID = uint32(pid)
-				if err := json.NewEncoder(w).Encode(i); err != nil {
-					s.logger.Error("Failed to encode JSON", "error", err.Error())
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-				w.WriteHeader(http.StatusOK)
-				return
-			}
+		s.logger.Info("[GET]", "from", r.RemoteAddr, "identity", identityOf(r))
+		i, ok := s.instances.Get(instance)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
 		}
-		w.WriteHeader(http.StatusNotFound)
+		s.annotate(i)
+		if err := json.NewEncoder(w).Encode(i); err != nil {
+			s.logger.Error("Failed to encode JSON", "error", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
 		return
 	case "POST":
-		s.logger.Info("[POST]", "from", r.RemoteAddr)
+		s.logger.Info("[POST]", "from", r.RemoteAddr, "identity", identityOf(r))
 		// Check if the instance already exists
-		for _, i := range s.instances {
-			if i.ID == uint32(instance) {
-				s.logger.Error("Instance already exists", "instance", instance)
-				w.WriteHeader(http.StatusConflict)
-				return
-			}
+		if _, ok := s.instances.Get(instance); ok {
+			s.logger.Error("Instance already exists", "instance", instance)
+			w.WriteHeader(http.StatusConflict)
+			return
 		}
-		var new radvd.Instance
-		if err := json.NewDecoder(r.Body).Decode(&new); err != nil {
-			s.logger.Error("Failed to decode JSON", "error", err.Error())
-			w.WriteHeader(http.StatusBadRequest)
+		new, ok := s.decodeInstance(w, r)
+		if !ok {
 			return
 		}
-		if new.ID != uint32(instance) {
+		if new.ID != instance {
 			s.logger.Error("Instance ID mismatch", "instance", instance, "instance in body", new.ID)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		// generate radvd config file
-		if err := radvd.GenerateRadvdConfigFile(&new, radvd.RadvdConfPath); err != nil {
-			s.logger.Error("Failed to generate radvd config file", "error", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
+		if err := s.createInstance(new); err != nil {
+			writeErrors(w, err.status, Error{Type: "application", Tag: err.tag, Message: err.Error()})
 			return
 		}
-		if err := radvd.CheckRadvdConfig(int(new.ID)); err != nil {
-			s.logger.Error("Failed to check radvd config", "error", err.Error())
+		w.WriteHeader(http.StatusCreated)
+		return
+	case "PUT":
+		s.logger.Info("[PUT]", "from", r.RemoteAddr, "identity", identityOf(r))
+		new, ok := s.decodeInstance(w, r)
+		if !ok {
+			return
+		}
+		if new.ID != instance {
+			s.logger.Error("Instance ID mismatch", "instance", instance, "instance in body", new.ID)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		// start radvd process
-		if err := radvd.StartRadvd(int(new.ID)); err != nil {
-			s.logger.Error("Failed to start radvd", "error", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
+		created, err := s.replaceInstance(new)
+		if err != nil {
+			writeErrors(w, err.status, Error{Type: "application", Tag: err.tag, Message: err.Error()})
 			return
 		}
-		s.instances = append(s.instances, &new)
-		w.WriteHeader(http.StatusCreated)
+		if created {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 		return
-	case "PUT":
 	case "DELETE":
+		s.logger.Info("[DELETE]", "from", r.RemoteAddr, "identity", identityOf(r))
+		if _, ok := s.instances.Get(instance); !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := s.deleteInstance(instance); err != nil {
+			s.logger.Error("Failed to stop radvd", "error", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
 	default:
 		s.logger.Error("Method not allowed")
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -156,35 +210,266 @@ func (s *RadvdManagerServer) handleInstance(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-func (s *RadvdManagerServer) CleanUp() error {
-	for _, i := range s.instances {
-		if err := radvd.StopRadvd(int(i.ID)); err != nil {
-			continue
+// opError is a failed operation on an instance, with the HTTP status and
+// the RESTCONF error-tag to report.
+type opError struct {
+	status int
+	tag    string
+	err    error
+}
+
+func (e *opError) Error() string {
+	return e.err.Error()
+}
+
+// configureError reports options that radvd does not support as 501, other failures as 500.
+func configureError(err error) *opError {
+	var unsupported *radvd.UnsupportedError
+	if errors.As(err, &unsupported) {
+		return &opError{http.StatusNotImplemented, "operation-not-supported", err}
+	}
+	return &opError{http.StatusInternalServerError, "operation-failed", err}
+}
+
+// createInstance configures and starts a new instance.
+func (s *RadvdManagerServer) createInstance(new *radvd.Instance) *opError {
+	unlock := s.instances.Lock(new.ID)
+	defer unlock()
+	if _, ok := s.instances.Get(new.ID); ok {
+		s.logger.Error("Instance already exists", "instance", new.ID)
+		return &opError{http.StatusConflict, "data-exists", fmt.Errorf("instance %d already exists", new.ID)}
+	}
+	// generate radvd config file
+	if err := s.manager.Configure(new); err != nil {
+		s.logger.Error("Failed to generate radvd config file", "error", err.Error())
+		return configureError(err)
+	}
+	if err := s.manager.Check(int(new.ID)); err != nil {
+		s.logger.Error("Failed to check radvd config", "error", err.Error())
+		// do not leave the broken config file behind
+		s.manager.Unconfigure(int(new.ID))
+		return &opError{http.StatusBadRequest, "invalid-value", err}
+	}
+	// start radvd process
+	if err := s.manager.Start(int(new.ID)); err != nil {
+		s.logger.Error("Failed to start radvd", "error", err.Error())
+		s.manager.Unconfigure(int(new.ID))
+		return &opError{http.StatusInternalServerError, "operation-failed", err}
+	}
+	s.instances.Put(new)
+	s.saveState()
+	return nil
+}
+
+// replaceInstance reconfigures and reloads an instance, or creates it if it does not exist.
+func (s *RadvdManagerServer) replaceInstance(new *radvd.Instance) (bool, *opError) {
+	unlock := s.instances.Lock(new.ID)
+	defer unlock()
+	old, _ := s.instances.Get(new.ID)
+	// generate radvd config file
+	if err := s.manager.Configure(new); err != nil {
+		s.logger.Error("Failed to generate radvd config file", "error", err.Error())
+		return false, configureError(err)
+	}
+	if err := s.manager.Check(int(new.ID)); err != nil {
+		s.logger.Error("Failed to check radvd config", "error", err.Error())
+		// restore the previous config so that the running process is not affected
+		s.restoreConfig(new.ID, old)
+		return false, &opError{http.StatusBadRequest, "invalid-value", err}
+	}
+	// reload radvd process, or start it if it is not running
+	if err := s.manager.Reload(int(new.ID)); errors.Is(err, radvd.ErrNotRunning) {
+		s.logger.Info("radvd is not running, starting it", "instance", new.ID)
+		if err := s.manager.Start(int(new.ID)); err != nil {
+			s.logger.Error("Failed to start radvd", "error", err.Error())
+			s.restoreConfig(new.ID, old)
+			return false, &opError{http.StatusInternalServerError, "operation-failed", err}
 		}
+	} else if err != nil {
+		s.logger.Error("Failed to reload radvd", "error", err.Error())
+		// the registry keeps the old instance, so must the config file
+		s.restoreConfig(new.ID, old)
+		return false, &opError{http.StatusInternalServerError, "operation-failed", err}
+	}
+	s.instances.Put(new)
+	s.saveState()
+	return old == nil, nil
+}
+
+// restoreConfig writes the config file of the instance in the registry back,
+// or removes the config file if the instance is not in the registry.
+func (s *RadvdManagerServer) restoreConfig(id uint32, old *radvd.Instance) {
+	if old == nil {
+		s.manager.Unconfigure(int(id))
+		return
 	}
-	s.instances = []*radvd.Instance{}
+	if err := s.manager.Configure(old); err != nil {
+		s.logger.Error("Failed to restore radvd config file", "error", err.Error())
+	}
+}
 
-	files, err := filepath.Glob("/etc/radvd.d/*")
+// decodeInstance validates the request body against the YANG model and decodes it.
+// Violations are reported to the client as RESTCONF errors.
+func (s *RadvdManagerServer) decodeInstance(w http.ResponseWriter, r *http.Request) (*radvd.Instance, bool) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		s.logger.Error("Failed to glob files in /etc/radvd.d/", "error", err.Error())
+		s.logger.Error("Failed to read request body", "error", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	new, errs := s.parseInstance(body)
+	if errs != nil {
+		writeErrors(w, http.StatusBadRequest, errs...)
+		return nil, false
+	}
+	return new, true
+}
+
+// parseInstance validates the JSON encoded instance against the YANG model and decodes it.
+func (s *RadvdManagerServer) parseInstance(body []byte) (*radvd.Instance, []Error) {
+	violations := radvd.ValidateInstanceJSON(body)
+	var new radvd.Instance
+	if err := json.Unmarshal(body, &new); err != nil {
+		if len(violations) == 0 {
+			s.logger.Error("Failed to decode JSON", "error", err.Error())
+			return nil, []Error{{Type: "protocol", Tag: "malformed-message", Message: err.Error()}}
+		}
 	} else {
-		for _, file := range files {
-			if err := os.Remove(file); err != nil {
-				s.logger.Error("Failed to remove config file", "file", file, "error", err.Error())
+		// semantic checks, before anything is written to the config directory.
+		// A node that violates the schema is reported only once.
+		reported := make(map[string]bool)
+		for _, v := range violations {
+			reported[v.Path] = true
+		}
+		for _, v := range new.Validate() {
+			if !reported[v.Path] {
+				violations = append(violations, v)
 			}
 		}
 	}
-	pidFiles, err := filepath.Glob("/var/run/radvd/radvd.*")
-	if err != nil {
-		s.logger.Error("Failed to glob PID files in /var/run/radvd/", "error", err.Error())
-	} else {
-		for _, pidFile := range pidFiles {
-			if err := os.Remove(pidFile); err != nil {
-				s.logger.Error("Failed to remove PID file", "file", pidFile, "error", err.Error())
-			}
+	if len(violations) > 0 {
+		s.logger.Error("Invalid instance", "errors", len(violations), "error", violations[0].Error())
+		return nil, schemaErrors(violations)
+	}
+	return &new, nil
+}
+
+func schemaErrors(violations []radvd.SchemaError) []Error {
+	var errs []Error
+	for _, v := range violations {
+		errs = append(errs, Error{Type: "application", Tag: v.Tag, Path: v.Path, Message: v.Message})
+	}
+	return errs
+}
+
+// deleteInstance stops the radvd process of the instance and removes it from the registry.
+func (s *RadvdManagerServer) deleteInstance(id uint32) error {
+	unlock := s.instances.Lock(id)
+	defer unlock()
+	if _, ok := s.instances.Get(id); !ok {
+		return nil
+	}
+	if err := s.manager.Stop(int(id)); err != nil {
+		return err
+	}
+	s.instances.Delete(id)
+	s.saveState()
+	return nil
+}
+
+// restoreState adopts the instances listed in the state file. Running radvd
+// processes are kept as they are, dead ones are started again. Instances found
+// in the config directory but not in the state file are orphans and removed.
+// Without a state file, e.g. on the first start, every instance found is adopted.
+func (s *RadvdManagerServer) restoreState(found []*radvd.Instance) []*radvd.Instance {
+	state, err := LoadState(s.stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.logger.Info("No state file, adopting the instances found", "state_file", s.stateFile)
+		state = found
+	} else if err != nil {
+		s.logger.Error("Failed to load state, keeping existing instances", "error", err.Error())
+		return found
+	}
+	known := make(map[uint32]struct{})
+	for _, i := range state {
+		known[i.ID] = struct{}{}
+	}
+
+	instances := []*radvd.Instance{}
+	for _, i := range found {
+		if i.ID == 0 {
+			instances = append(instances, i)
+			continue
+		}
+		if _, ok := known[i.ID]; ok {
+			continue
+		}
+		s.logger.Info("Removing orphan radvd instance", "instance", i.ID)
+		if err := s.manager.Stop(int(i.ID)); err != nil {
+			s.logger.Error("Failed to remove orphan radvd instance", "instance", i.ID, "error", err.Error())
+		}
+	}
+	for _, i := range state {
+		if i.ID == 0 {
+			continue
+		}
+		instances = append(instances, i)
+		if pid, err := s.manager.Adopt(int(i.ID)); err == nil {
+			s.logger.Info("Adopted running radvd", "instance", i.ID, "pid", pid)
+			continue
+		}
+		s.logger.Info("Restarting radvd", "instance", i.ID)
+		if err := s.manager.Configure(i); err != nil {
+			s.logger.Error("Failed to generate radvd config file", "instance", i.ID, "error", err.Error())
+			continue
+		}
+		if err := s.manager.Start(int(i.ID)); err != nil {
+			s.logger.Error("Failed to start radvd", "instance", i.ID, "error", err.Error())
 		}
 	}
 
+	return instances
+}
+
+// annotate fills the runtime status of the instance.
+func (s *RadvdManagerServer) annotate(i *radvd.Instance) {
+	status := s.manager.Status(int(i.ID))
+	i.PID = uint32(status.PID)
+	i.State = status.State
+	i.Restarts = status.Restarts
+	i.LastExit = status.LastExit
+	i.LastStderr = status.LastStderr
+}
+
+// saveState writes the registry to the state file, if persistence is enabled.
+func (s *RadvdManagerServer) saveState() {
+	if s.stateFile == "" {
+		return
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	instances := []*radvd.Instance{}
+	for _, i := range s.instances.Snapshot() {
+		if i.ID != 0 {
+			instances = append(instances, i)
+		}
+	}
+	if err := SaveState(s.stateFile, instances); err != nil {
+		s.logger.Error("Failed to save state", "error", err.Error())
+	}
+}
+
+func (s *RadvdManagerServer) CleanUp() error {
+	for _, i := range s.instances.Snapshot() {
+		unlock := s.instances.Lock(i.ID)
+		s.manager.Stop(int(i.ID))
+		s.instances.Delete(i.ID)
+		unlock()
+	}
+	if err := s.manager.CleanUp(); err != nil {
+		s.logger.Error("Failed to clean up radvd files", "error", err.Error())
+	}
+
 	s.logger.Info("Stopped all radvd instances")
 	return nil
 }
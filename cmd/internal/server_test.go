@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+// newTestServer serves a server backed by the fake manager.
+func newTestServer(t *testing.T, opts ServerOptions) (*httptest.Server, *radvd.RadvdManager, *radvd.FakeExecutor, *radvd.MemFS) {
+	t.Helper()
+	manager, exec, fs := radvd.NewFakeManager()
+	if opts.Manager == nil {
+		opts.Manager = manager
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := NewServer("", nil, logger, opts)
+	ts := httptest.NewServer(srv.Handler)
+	t.Cleanup(ts.Close)
+	return ts, manager, exec, fs
+}
+
+func testInstance(id uint32) *radvd.Instance {
+	return &radvd.Instance{
+		ID:                   id,
+		Name:                 "eth1",
+		AdvSendAdvert:        true,
+		AdvDefaultPreference: "medium",
+		MinRtrAdvInterval:    3,
+		MaxRtrAdvInterval:    10,
+		Prefixes: []radvd.Prefix{
+			{Prefix: "2001:db8::/64", AdvOnLink: true, AdvAutonomous: true, AdvValidLifetime: 86400},
+		},
+	}
+}
+
+// jsonBody encodes the request body, nil is an empty body.
+func jsonBody(t *testing.T, body any) io.Reader {
+	t.Helper()
+	if body == nil {
+		return nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(data)
+}
+
+func do(t *testing.T, ts *httptest.Server, method, path string, body any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, jsonBody(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServerPutWhileRestarting(t *testing.T) {
+	manager, exec, fs := radvd.NewFakeManager()
+	manager.Supervisor.MinBackoff = 50 * time.Millisecond
+	ts, _, _, _ := newTestServer(t, ServerOptions{Manager: manager})
+
+	i := testInstance(1)
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", i); resp.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("POST: %s %s", resp.Status, b)
+	}
+	pid := manager.Status(1).PID
+	exec.Crash(pid)
+	for manager.Status(1).State != radvd.StateRestarting {
+		time.Sleep(time.Millisecond)
+	}
+
+	i.AdvDefaultLifetime = 600
+	if resp := do(t, ts, "PUT", "/rest/data/radvd:instances/1", i); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT while restarting: %s", resp.Status)
+	}
+	if _, err := fs.ReadFile(radvd.DefaultPaths().ConfFile(1)); err != nil {
+		t.Fatalf("config file was removed: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.Status(1).State != radvd.StateRunning || manager.Status(1).PID == pid {
+		if time.Now().After(deadline) {
+			t.Fatalf("radvd was not respawned: %+v", manager.Status(1))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	var got radvd.Instance
+	json.NewDecoder(do(t, ts, "GET", "/rest/data/radvd:instances/1", nil).Body).Decode(&got)
+	if got.AdvDefaultLifetime != 600 {
+		t.Fatalf("registry kept the old instance: adv_default_lifetime = %d", got.AdvDefaultLifetime)
+	}
+}
+
+// failingReload is a manager whose radvd can not be reloaded.
+type failingReload struct {
+	radvd.Manager
+}
+
+func (failingReload) Reload(int) error {
+	return errors.New("reload failed")
+}
+
+func TestServerPutReloadFailure(t *testing.T) {
+	manager, _, fs := radvd.NewFakeManager()
+	ts, _, _, _ := newTestServer(t, ServerOptions{Manager: failingReload{manager}})
+	i := testInstance(1)
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", i); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: %s", resp.Status)
+	}
+	conf, _ := fs.ReadFile(radvd.DefaultPaths().ConfFile(1))
+
+	changed := testInstance(1)
+	changed.AdvDefaultLifetime = 600
+	if resp := do(t, ts, "PUT", "/rest/data/radvd:instances/1", changed); resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("PUT with a failing reload: %s", resp.Status)
+	}
+	if got, _ := fs.ReadFile(radvd.DefaultPaths().ConfFile(1)); !bytes.Equal(got, conf) {
+		t.Fatalf("config file was not restored:\n%s\nwant\n%s", got, conf)
+	}
+	var got radvd.Instance
+	json.NewDecoder(do(t, ts, "GET", "/rest/data/radvd:instances/1", nil).Body).Decode(&got)
+	if !got.Equal(i) {
+		t.Fatalf("registry = %+v, want %+v", got, i)
+	}
+}
+
+func TestServerInstanceLifecycle(t *testing.T) {
+	ts, manager, exec, fs := newTestServer(t, ServerOptions{})
+	paths := radvd.DefaultPaths()
+
+	i := testInstance(1)
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", i); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: %s", resp.Status)
+	}
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", i); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST of an existing instance: %s", resp.Status)
+	}
+	if len(exec.Running()) != 1 {
+		t.Fatalf("running radvd: %v", exec.Running())
+	}
+
+	resp := do(t, ts, "GET", "/rest/data/radvd:instances/1", nil)
+	var got radvd.Instance
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(i) {
+		t.Fatalf("GET = %+v, want %+v", got, i)
+	}
+	if got.State != radvd.StateRunning || int(got.PID) != exec.Running()[0] {
+		t.Fatalf("GET: state %q, pid %d", got.State, got.PID)
+	}
+
+	i.Prefixes[0].AdvValidLifetime = 3600
+	if resp := do(t, ts, "PUT", "/rest/data/radvd:instances/1", i); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT: %s", resp.Status)
+	}
+	if exec.Reloads(int(got.PID)) != 1 {
+		t.Fatal("PUT did not reload radvd")
+	}
+	conf, _ := fs.ReadFile(paths.ConfFile(1))
+	if !bytes.Contains(conf, []byte("AdvValidLifetime 3600;")) {
+		t.Fatalf("config was not updated:\n%s", conf)
+	}
+	if resp := do(t, ts, "PUT", "/rest/data/radvd:instances/2", testInstance(2)); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT of a new instance: %s", resp.Status)
+	}
+
+	var all []*radvd.Instance
+	json.NewDecoder(do(t, ts, "GET", "/rest/data/radvd:instances", nil).Body).Decode(&all)
+	if len(all) != 3 || all[0].ID != 0 || all[1].ID != 1 || all[2].ID != 2 {
+		t.Fatalf("GET collection: %+v", all)
+	}
+
+	if resp := do(t, ts, "DELETE", "/rest/data/radvd:instances/1", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: %s", resp.Status)
+	}
+	if resp := do(t, ts, "DELETE", "/rest/data/radvd:instances/1", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("DELETE of a deleted instance: %s", resp.Status)
+	}
+	if resp := do(t, ts, "GET", "/rest/data/radvd:instances/1", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET of a deleted instance: %s", resp.Status)
+	}
+	if _, err := fs.ReadFile(paths.ConfFile(1)); err == nil {
+		t.Fatal("config file of the deleted instance was kept")
+	}
+
+	if resp := do(t, ts, "DELETE", "/rest/data/radvd:instances", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE collection: %s", resp.Status)
+	}
+	if len(exec.Running()) != 0 {
+		t.Fatalf("radvd still running: %v", exec.Running())
+	}
+	if ids := manager.Supervisor.IDs(); len(ids) != 0 {
+		t.Fatalf("still supervised: %v", ids)
+	}
+	all = nil
+	json.NewDecoder(do(t, ts, "GET", "/rest/data/radvd:instances", nil).Body).Decode(&all)
+	if len(all) != 1 || all[0].ID != 0 {
+		t.Fatalf("the default instance must survive: %+v", all)
+	}
+}
+
+func TestServerRejectsInvalidInstances(t *testing.T) {
+	ts, _, exec, fs := newTestServer(t, ServerOptions{})
+
+	invalid := testInstance(1)
+	invalid.Prefixes[0].Prefix = "2001:db8::1"
+	resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", invalid)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("POST of an invalid prefix: %s", resp.Status)
+	}
+	var body errorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	if len(body.Errors.Error) != 1 || body.Errors.Error[0].Path != "/radvd:instances/instance/prefixes[0]/prefix" {
+		t.Fatalf("errors: %+v", body.Errors.Error)
+	}
+
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/2", testInstance(1)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("POST with an ID mismatch: %s", resp.Status)
+	}
+	if resp := do(t, ts, "PUT", "/rest/data/radvd:instances/0", testInstance(0)); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("PUT of the default instance: %s", resp.Status)
+	}
+
+	// radvd --configtest rejects the config
+	exec.CheckConfig = func([]byte) error { return errors.New("syntax error") }
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", testInstance(1)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("POST of a config rejected by radvd: %s", resp.Status)
+	}
+	if _, err := fs.ReadFile(radvd.DefaultPaths().ConfFile(1)); err == nil {
+		t.Fatal("rejected config file was kept")
+	}
+	if len(exec.Running()) != 0 {
+		t.Fatalf("radvd started with a rejected config: %v", exec.Running())
+	}
+}
+
+func TestServerStartupMultipleInterfaces(t *testing.T) {
+	manager, exec, fs := radvd.NewFakeManager()
+	manager.Supervisor.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	paths := radvd.DefaultPaths()
+	fs.WriteFile(paths.DefaultConf, []byte("interface eth0 {\n};\n\ninterface eth1 {\n};\n"), 0644)
+	if err := manager.Configure(testInstance(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Start(1); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, _, _, _ := newTestServer(t, ServerOptions{Manager: manager})
+	var all []*radvd.Instance
+	json.NewDecoder(do(t, ts, "GET", "/rest/data/radvd:instances", nil).Body).Decode(&all)
+	if len(all) != 2 || all[0].ID != 0 || all[1].ID != 1 {
+		t.Fatalf("GET collection: %+v", all)
+	}
+	if len(all[0].OtherInterfaces) != 1 {
+		t.Fatalf("other interfaces of the default instance: %q", all[0].OtherInterfaces)
+	}
+	// the running instance is known, so it is not started a second time
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", testInstance(1)); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("POST of a running instance: %s", resp.Status)
+	}
+	if running := exec.Running(); len(running) != 1 {
+		t.Fatalf("running radvd: %v", running)
+	}
+}
+
+func TestServerUnsupportedByRadvd(t *testing.T) {
+	manager, exec, _ := radvd.NewFakeManager()
+	exec.Version = "2.18"
+	ts, _, _, _ := newTestServer(t, ServerOptions{Manager: manager})
+	i := testInstance(1)
+	i.Nat64Prefixes = []radvd.NAT64Prefix{{Prefix: "64:ff9b::/96"}}
+	for _, method := range []string{"POST", "PUT"} {
+		resp := do(t, ts, method, "/rest/data/radvd:instances/1", i)
+		var body errorBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusNotImplemented {
+			t.Fatalf("%s with PREF64 on radvd 2.18: %s", method, resp.Status)
+		}
+		if len(body.Errors.Error) != 1 || body.Errors.Error[0].Tag != "operation-not-supported" {
+			t.Fatalf("%s: errors %+v", method, body.Errors.Error)
+		}
+	}
+	if running := exec.Running(); len(running) != 0 {
+		t.Fatalf("radvd was started: %v", running)
+	}
+}
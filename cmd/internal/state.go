@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+// SaveState writes the instances to the state file. The file is replaced
+// atomically, so a crash while saving never leaves a truncated state behind.
+func SaveState(path string, instances []*radvd.Instance) error {
+	jsonData, err := json.MarshalIndent(instances, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(jsonData); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
+	return nil
+}
+
+// LoadState reads the instances from the state file. A missing state file
+// is an error that matches fs.ErrNotExist; it is not the same as no instances.
+func LoadState(path string) ([]*radvd.Instance, error) {
+	fileData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	instances := []*radvd.Instance{}
+	if err := json.Unmarshal(fileData, &instances); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state file: %w", err)
+	}
+
+	return instances, nil
+}
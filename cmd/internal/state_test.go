@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	radvd "github.com/y-kzm/go-radvd-manager"
+)
+
+// previousServer returns the manager of a server that is no longer running:
+// it does not restart the radvd processes it started when they exit.
+func previousServer() (*radvd.RadvdManager, *radvd.FakeExecutor, *radvd.MemFS) {
+	manager, exec, fs := radvd.NewFakeManager()
+	manager.Supervisor.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager.Supervisor.MaxRestarts = 0
+	return manager, exec, fs
+}
+
+// restart returns the manager of a new server on the same system.
+func restart(exec *radvd.FakeExecutor, fs *radvd.MemFS) *radvd.RadvdManager {
+	return radvd.NewManager(exec, fs, radvd.DefaultPaths(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestSaveLoadState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	instances := []*radvd.Instance{testInstance(1), testInstance(2)}
+	if err := SaveState(path, instances); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Equal(instances[0]) || !got[1].Equal(instances[1]) {
+		t.Fatalf("LoadState = %+v, want %+v", got, instances)
+	}
+	// no temporary file is left behind
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("files in the state directory: %v", files)
+	}
+
+	if err := SaveState(path, []*radvd.Instance{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LoadState(path); err != nil || len(got) != 0 {
+		t.Fatalf("LoadState of an empty state = %v, %v", got, err)
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadState(filepath.Join(dir, "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("LoadState of a missing file = %v, want fs.ErrNotExist", err)
+	}
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte("[{"), 0644)
+	if _, err := LoadState(broken); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("LoadState of a broken file = %v", err)
+	}
+}
+
+func TestServerRestoreState(t *testing.T) {
+	manager, exec, fs := previousServer()
+	state := filepath.Join(t.TempDir(), "state.json")
+	ts, _, _, _ := newTestServer(t, ServerOptions{Manager: manager, StateFile: state})
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", testInstance(1)); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: %s", resp.Status)
+	}
+	pid := exec.Running()[0]
+
+	// the server restarts and leaves radvd running
+	next := restart(exec, fs)
+	ts, _, _, _ = newTestServer(t, ServerOptions{Manager: next, StateFile: state})
+	if running := exec.Running(); len(running) != 1 || running[0] != pid {
+		t.Fatalf("radvd was restarted: %v, want %d", running, pid)
+	}
+	var got radvd.Instance
+	json.NewDecoder(do(t, ts, "GET", "/rest/data/radvd:instances/1", nil).Body).Decode(&got)
+	if int(got.PID) != pid || got.State != radvd.StateRunning {
+		t.Fatalf("adopted instance: pid %d, state %q", got.PID, got.State)
+	}
+}
+
+func TestServerRestoreStateRestartsDead(t *testing.T) {
+	manager, exec, fs := previousServer()
+	state := filepath.Join(t.TempDir(), "state.json")
+	ts, _, _, _ := newTestServer(t, ServerOptions{Manager: manager, StateFile: state})
+	if resp := do(t, ts, "POST", "/rest/data/radvd:instances/1", testInstance(1)); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: %s", resp.Status)
+	}
+	// radvd dies while no server is running
+	pid := exec.Running()[0]
+	exec.Crash(pid)
+
+	next := restart(exec, fs)
+	newTestServer(t, ServerOptions{Manager: next, StateFile: state})
+	if running := exec.Running(); len(running) != 1 || running[0] == pid {
+		t.Fatalf("running radvd: %v, want a new process", running)
+	}
+}
+
+func TestServerFirstStartAdopts(t *testing.T) {
+	// radvd was started before the state file was configured
+	manager, exec, fs := previousServer()
+	if err := manager.Configure(testInstance(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	pid := exec.Running()[0]
+
+	state := filepath.Join(t.TempDir(), "state.json")
+	next := restart(exec, fs)
+	ts, _, _, _ := newTestServer(t, ServerOptions{Manager: next, StateFile: state})
+	if running := exec.Running(); len(running) != 1 || running[0] != pid {
+		t.Fatalf("running radvd: %v, want %d", running, pid)
+	}
+	if _, err := fs.ReadFile(radvd.DefaultPaths().ConfFile(1)); err != nil {
+		t.Fatalf("config file was removed: %v", err)
+	}
+	var got radvd.Instance
+	json.NewDecoder(do(t, ts, "GET", "/rest/data/radvd:instances/1", nil).Body).Decode(&got)
+	if int(got.PID) != pid || got.State != radvd.StateRunning {
+		t.Fatalf("adopted instance: pid %d, state %q", got.PID, got.State)
+	}
+}
+
+func TestServerRestoreStateRemovesOrphans(t *testing.T) {
+	manager, exec, fs := previousServer()
+	if err := manager.Configure(testInstance(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Start(2); err != nil {
+		t.Fatal(err)
+	}
+	// the state file lists instance 1 only
+	state := filepath.Join(t.TempDir(), "state.json")
+	if err := SaveState(state, []*radvd.Instance{testInstance(1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	next := restart(exec, fs)
+	ts, _, _, _ := newTestServer(t, ServerOptions{Manager: next, StateFile: state})
+	if _, err := fs.ReadFile(radvd.DefaultPaths().ConfFile(2)); err == nil {
+		t.Fatal("config file of the orphan was kept")
+	}
+	if resp := do(t, ts, "GET", "/rest/data/radvd:instances/2", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET of the orphan: %s", resp.Status)
+	}
+	if resp := do(t, ts, "GET", "/rest/data/radvd:instances/1", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET of the instance in the state file: %s", resp.Status)
+	}
+	if running := exec.Running(); len(running) != 1 {
+		t.Fatalf("running radvd: %v, want instance 1 only", running)
+	}
+}
@@ -2,23 +2,45 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	radvd "github.com/y-kzm/go-radvd-manager"
 	server "github.com/y-kzm/go-radvd-manager/cmd/internal"
 )
 
-const (
-	port = 12345
-)
-
 func main() {
-	endpoint := fmt.Sprintf("[::]:%d", port)
+	configFlag := flag.String("config", "", "Server config file (YAML)")
+	// every setting can also be given as a flag, e.g. -tls-cert for tls_cert
+	flags := make(map[string]*string)
+	for name := range server.DefaultServerConfig().Fields() {
+		flagName := strings.ReplaceAll(name, "_", "-")
+		flags[name] = flag.String(flagName, "", "Overrides "+name+" of the config file (env: RADVD_MANAGER_"+strings.ToUpper(name)+")")
+	}
+	flag.Parse()
+
+	config, err := server.LoadServerConfig(*configFlag)
+	if err != nil {
+		slog.Error("Failed to load server config", "error", err.Error())
+		os.Exit(1)
+	}
+	config.ApplyEnv()
+	fields := config.Fields()
+	flag.Visit(func(f *flag.Flag) {
+		name := strings.ReplaceAll(f.Name, "-", "_")
+		if value, ok := fields[name]; ok {
+			*value = *flags[name]
+		}
+	})
+	if err := config.Validate(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
 
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
@@ -27,21 +49,61 @@ func main() {
 	defer cancel()
 
 	instances := []*radvd.Instance{}
+	logger := slog.With("component", "radvdManagerServer")
+
+	tlsConfig, err := config.ServerTLSConfig()
+	if err != nil {
+		slog.Error("Failed to configure TLS", "error", err.Error())
+		os.Exit(1)
+	}
+	var authz *server.AuthzPolicy
+	if config.AuthzPolicy != "" {
+		if authz, err = server.LoadAuthzPolicy(config.AuthzPolicy); err != nil {
+			slog.Error("Failed to load authorization policy", "error", err.Error())
+			os.Exit(1)
+		}
+	}
+	manager := radvd.NewManager(radvd.OSExecutor{}, radvd.OSFileSystem{}, config.Paths, logger)
+	if config.Paths.TemplateDir != "" {
+		if manager.Templates, err = radvd.LoadTemplates(config.Paths.TemplateDir); err != nil {
+			slog.Error("Failed to load templates", "error", err.Error())
+			os.Exit(1)
+		}
+	}
+	if len(config.Tokens) > 0 && config.TLS.Cert == "" {
+		slog.Warn("Bearer tokens are sent in clear text without TLS")
+	}
 
 	go func() {
-		srv := server.NewServer(endpoint, instances, slog.With("component", "radvdManagerServer"))
+		srv := server.NewServer(config.Listen, instances, logger, server.ServerOptions{
+			StateFile:         config.StateFile,
+			Manager:           manager,
+			Tokens:            config.Tokens,
+			RequireClientCert: config.TLS.ClientCA != "",
+			Authz:             authz,
+		})
+		srv.TLSConfig = tlsConfig
 		go func() {
 			<-signalChan
 			slog.Info("Received signal, shutting down server")
 
-			srv.CleanUp()
+			// keep radvd running when the state is persisted, so that
+			// restarting the server does not interrupt RAs
+			if config.StateFile == "" {
+				srv.CleanUp()
+			}
 			if err := srv.Shutdown(context.Background()); err != nil {
 				slog.Error("Failt to shutdown server", "error", err.Error())
 			}
 			cancel()
 		}()
-		slog.Info("Starting HTTP server", "endpoint", endpoint)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Info("Starting HTTP server", "endpoint", config.Listen, "tls", config.TLS.Cert != "", "mtls", config.TLS.ClientCA != "", "tokens", len(config.Tokens))
+		if config.TLS.Cert != "" {
+			err = srv.ListenAndServeTLS(config.TLS.Cert, config.TLS.Key)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			slog.Error("Failed to start server", "error", err.Error())
 		}
 	}()
@@ -0,0 +1,335 @@
+package radvd_manager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RadvdConf is a parsed radvd.conf.
+type RadvdConf struct {
+	// Interfaces are the interface blocks, in the order of the file.
+	Interfaces []*Directive
+	// Trailing are the comments after the last interface block.
+	Trailing []string
+}
+
+// Directive is a statement of radvd.conf: an option such as "AdvSendAdvert on;"
+// or a block such as "prefix 2001:db8::/64 { ... };". Unknown directives are
+// kept as they are.
+type Directive struct {
+	Name string
+	Args []string
+	// IsBlock is set for directives with braces, Block are the statements inside.
+	IsBlock bool
+	Block   []*Directive
+	// Comments are the comment lines before the directive, including "#".
+	Comments []string
+	// Trailing are the comments before the closing brace of a block.
+	Trailing []string
+	// Inline is the comment on the same line after the directive.
+	Inline string
+	Pos    Position
+
+	// byte offsets in the parsed file, used to edit it in place
+	span span
+}
+
+type span struct {
+	// start of the first leading comment, or of the name
+	comment int
+	// start of the name, and end after the final ";"
+	start, end int
+	// start and end of each argument
+	args [][2]int
+	// offset of the closing brace of a block
+	close int
+}
+
+// Position is a location in a config file. Line and Col start at 1.
+type Position struct {
+	File string
+	Line int
+	Col  int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// ConfError is a syntax or value error in radvd.conf.
+type ConfError struct {
+	Pos Position
+	Msg string
+}
+
+func (e *ConfError) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// ParseRadvdConf parses radvd.conf. name is the file name used in errors.
+func ParseRadvdConf(name string, data []byte) (*RadvdConf, error) {
+	p, err := newConfParser(name, data)
+	if err != nil {
+		return nil, err
+	}
+	var conf RadvdConf
+	for {
+		d, err := p.directive()
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			break
+		}
+		if d.Name != "interface" {
+			return nil, &ConfError{d.Pos, fmt.Sprintf("unexpected %q, only interface blocks are allowed at the top level", d.Name)}
+		}
+		if !d.IsBlock || len(d.Args) != 1 {
+			return nil, &ConfError{d.Pos, "expected \"interface <name> { ... };\""}
+		}
+		conf.Interfaces = append(conf.Interfaces, d)
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	conf.Trailing = p.comments
+	return &conf, nil
+}
+
+// parseDirective parses a single statement, e.g. an Extra entry of an instance.
+func parseDirective(data string) (*Directive, error) {
+	p, err := newConfParser("directive", []byte(data))
+	if err != nil {
+		return nil, err
+	}
+	d, err := p.directive()
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("empty directive")
+	}
+	if err := p.end(); err != nil {
+		return nil, fmt.Errorf("%q is more than one directive", data)
+	}
+	if len(d.Comments) > 0 || d.Inline != "" || len(p.comments) > 0 {
+		return nil, fmt.Errorf("%q contains a comment", data)
+	}
+	return d, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpen
+	tokenClose
+	tokenSemicolon
+	tokenComment
+	tokenEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  Position
+	off  int
+}
+
+// tokenizeConf splits radvd.conf into words, quoted strings, braces,
+// semicolons and comments.
+func tokenizeConf(name string, data []byte) ([]token, error) {
+	var tokens []token
+	line, col := 1, 1
+	for n := 0; n < len(data); {
+		c := data[n]
+		pos := Position{name, line, col}
+		switch {
+		case c == '\n':
+			line, col = line+1, 1
+			n++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+		case c == '#':
+			end := n
+			for end < len(data) && data[end] != '\n' {
+				end++
+			}
+			tokens = append(tokens, token{tokenComment, strings.TrimRight(string(data[n:end]), " \t\r"), pos, n})
+			col += end - n
+			n = end
+			continue
+		case c == '{':
+			tokens = append(tokens, token{tokenOpen, "{", pos, n})
+		case c == '}':
+			tokens = append(tokens, token{tokenClose, "}", pos, n})
+		case c == ';':
+			tokens = append(tokens, token{tokenSemicolon, ";", pos, n})
+		case c == '"':
+			end := n + 1
+			for end < len(data) && data[end] != '"' && data[end] != '\n' {
+				end++
+			}
+			if end == len(data) || data[end] != '"' {
+				return nil, &ConfError{pos, "unterminated string"}
+			}
+			tokens = append(tokens, token{tokenString, string(data[n : end+1]), pos, n})
+			col += end + 1 - n
+			n = end + 1
+			continue
+		default:
+			end := n
+			for end < len(data) && !strings.ContainsRune(" \t\r\n{};#\"", rune(data[end])) {
+				end++
+			}
+			tokens = append(tokens, token{tokenWord, string(data[n:end]), pos, n})
+			col += end - n
+			n = end
+			continue
+		}
+		col++
+		n++
+	}
+	tokens = append(tokens, token{tokenEOF, "", Position{name, line, col}, len(data)})
+	return tokens, nil
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of file"
+	}
+	return strconv.Quote(t.text)
+}
+
+type confParser struct {
+	tokens []token
+	n      int
+	// comments read but not yet attached to a directive, and the offset of the first one
+	comments     []string
+	commentStart int
+}
+
+func newConfParser(name string, data []byte) (*confParser, error) {
+	tokens, err := tokenizeConf(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return &confParser{tokens: tokens}, nil
+}
+
+// peek returns the next token that is not a comment. Comments are collected.
+func (p *confParser) peek() token {
+	for p.tokens[p.n].kind == tokenComment {
+		if len(p.comments) == 0 {
+			p.commentStart = p.tokens[p.n].off
+		}
+		p.comments = append(p.comments, p.tokens[p.n].text)
+		p.n++
+	}
+	return p.tokens[p.n]
+}
+
+func (p *confParser) next() token {
+	t := p.peek()
+	if t.kind != tokenEOF {
+		p.n++
+	}
+	return t
+}
+
+// end fails unless all tokens have been read.
+func (p *confParser) end() error {
+	if t := p.next(); t.kind != tokenEOF {
+		return &ConfError{t.pos, fmt.Sprintf("unexpected %s", t)}
+	}
+	return nil
+}
+
+// directive parses the next statement. It returns nil at the end of the
+// input or of the enclosing block, leaving the closing brace unread.
+func (p *confParser) directive() (*Directive, error) {
+	t := p.peek()
+	if t.kind == tokenEOF || t.kind == tokenClose {
+		return nil, nil
+	}
+	t = p.next()
+	if t.kind != tokenWord {
+		return nil, &ConfError{t.pos, fmt.Sprintf("expected a directive, found %s", t)}
+	}
+	d := &Directive{Name: t.text, Comments: p.comments, Pos: t.pos}
+	d.span.start, d.span.comment = t.off, t.off
+	if len(p.comments) > 0 {
+		d.span.comment = p.commentStart
+	}
+	p.comments = nil
+	for {
+		t = p.next()
+		switch t.kind {
+		case tokenWord, tokenString:
+			d.Args = append(d.Args, t.text)
+			d.span.args = append(d.span.args, [2]int{t.off, t.off + len(t.text)})
+			continue
+		case tokenSemicolon:
+			p.finish(d, t)
+			return d, nil
+		case tokenOpen:
+			d.IsBlock = true
+			for {
+				child, err := p.directive()
+				if err != nil {
+					return nil, err
+				}
+				if child == nil {
+					break
+				}
+				d.Block = append(d.Block, child)
+			}
+			d.Trailing, p.comments = p.comments, nil
+			if t = p.next(); t.kind != tokenClose {
+				return nil, &ConfError{t.pos, fmt.Sprintf("missing \"}\" for %s at %d:%d", d.Name, d.Pos.Line, d.Pos.Col)}
+			}
+			d.span.close = t.off
+			if t = p.next(); t.kind != tokenSemicolon {
+				return nil, &ConfError{t.pos, fmt.Sprintf("expected \";\" after \"}\" of %s, found %s", d.Name, t)}
+			}
+			p.finish(d, t)
+			return d, nil
+		case tokenEOF:
+			return nil, &ConfError{t.pos, fmt.Sprintf("unexpected end of file in %s", d.Name)}
+		default:
+			return nil, &ConfError{t.pos, fmt.Sprintf("unexpected %s in %s", t, d.Name)}
+		}
+	}
+}
+
+// finish records the end of the directive at its ";" and takes a comment
+// on the same line as its inline comment.
+func (p *confParser) finish(d *Directive, semicolon token) {
+	d.span.end = semicolon.off + 1
+	if t := p.tokens[p.n]; t.kind == tokenComment && t.pos.Line == semicolon.pos.Line {
+		d.Inline = t.text
+		p.n++
+	}
+}
+
+// String returns the directive on a single line, e.g. "abro fe80::1 { AdvVersionLow 10; };".
+// Comments are not included.
+func (d *Directive) String() string {
+	var b strings.Builder
+	b.WriteString(d.Name)
+	for _, a := range d.Args {
+		b.WriteString(" " + a)
+	}
+	if !d.IsBlock {
+		b.WriteString(";")
+		return b.String()
+	}
+	b.WriteString(" {")
+	for _, c := range d.Block {
+		b.WriteString(" " + c.String())
+	}
+	b.WriteString(" };")
+	return b.String()
+}
@@ -1,24 +1,30 @@
 package radvd_manager
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"gopkg.in/yaml.v3"
 )
 
 const (
-	templateFile         = "radvd.template.conf"
-	RadvdConfPath        = "/etc/radvd.d/"
-	debugConfPath        = "./output/"
-	parameterFile        = "parameter.default.yaml"
+	RadvdConfPath = "/etc/radvd.d/"
+	// DefaultParameterFile is the parameter file read by the CLI unless another one is given
+	DefaultParameterFile = "parameter.default.yaml"
 	defaultRadvdCondFile = "/etc/radvd.conf"
+	// defaultDnsslLifetime is the lifetime of the search domains of a group without dnssl_lifetime
+	defaultDnsslLifetime = 1800
 )
 
 type Policy struct {
-	Rules  []Rule  `yaml:"rules" validate:"unique=ID,required,dive" default:"[]"`
-	Groups []Group `yaml:"groups" validate:"unique=ID,required,dive" default:"[]"`
+	Rules  []Rule  `yaml:"rules" validate:"required,min=1,dive" default:"[]"`
+	Groups []Group `yaml:"groups" validate:"required,min=1,dive" default:"[]"`
+	// lines maps the paths of the policy file, such as "groups[0].members[1]", to their line
+	lines map[string]int
 }
 
 type Rule struct {
@@ -26,95 +32,232 @@ type Rule struct {
 	Description string `yaml:"description"`
 	// Type        string   `yaml:"type" validate:"oneof=FQDNs Prefixes,required"`
 	// FQDNs       []string `yaml:"fqdn,omitempty" validate:"dive,domain"`
-	Prefixes []string `yaml:"prefixes,omitempty" validate:"dive,cidrv6"`
-	Nexthop  string   `yaml:"nexthop" validate:"ipv6,required"`
+	Prefixes []string `yaml:"prefixes,omitempty" validate:"required,min=1,dive,cidrv6"`
+	Nexthop  string   `yaml:"nexthop" validate:"required,ipv6"`
+	// RoutePreference and RouteLifetime are those of the routes of the prefixes,
+	// "medium" and 1800 seconds by default
+	RoutePreference string  `yaml:"route_preference,omitempty" validate:"omitempty,oneof=low medium high"`
+	RouteLifetime   *uint32 `yaml:"route_lifetime,omitempty"`
+	// DefaultRouter is the preference of the router as a default router, "high"
+	// for a "::/0" rule and "none" otherwise: a rule that only steers prefixes
+	// is advertised with adv_default_lifetime 0. DefaultLifetime overrides
+	// adv_default_lifetime of the parameters.
+	DefaultRouter   string  `yaml:"default_router,omitempty" validate:"omitempty,oneof=none low medium high"`
+	DefaultLifetime *uint32 `yaml:"default_lifetime,omitempty" validate:"omitempty,max=9000"`
 }
 
 type Group struct {
 	ID          int      `yaml:"id" validate:"required"`
 	Description string   `yaml:"description"`
-	Rules       []int    `yaml:"rules" validate:"dive,chechk_rule_exist,required"`
-	Members     []string `yaml:"members" validate:"dive,ipv6,required"`
+	Rules       []int    `yaml:"rules" validate:"required,min=1"`
+	Members     []string `yaml:"members" validate:"required,min=1,dive,unicast6"`
+	// Dnssl are the DNS search domains advertised to the members
+	Dnssl         []string `yaml:"dnssl,omitempty" validate:"dive,domain"`
+	DnsslLifetime uint32   `yaml:"dnssl_lifetime,omitempty"`
+	// Nat64Prefixes are advertised as PREF64 (RFC 8781), CaptivePortal as the captive portal API (RFC 8910)
+	Nat64Prefixes []string `yaml:"nat64_prefixes,omitempty" validate:"dive,pref64"`
+	CaptivePortal string   `yaml:"captive_portal,omitempty" validate:"omitempty,captiveportal"`
 }
 
+// ParsePolicy compiles the policy with the parameters of parameter.default.yaml,
+// which is read relative to the working directory.
+//
+// Deprecated: Load the parameters with LoadParameterFile and use Compile.
 func ParsePolicy(policy *Policy) ([]*Instance, error) {
-	instances := []*Instance{}
-	parameters, err := LoadParameterFile()
+	parameters, err := LoadParameterFile(DefaultParameterFile)
 	if err != nil {
-		log.Fatalf("Failed to marshal radvd to JSON: %v", err)
+		return nil, fmt.Errorf("failed to load parameter file: %v", err)
 	}
+	return Compile(policy, parameters)
+}
+
+// Compile converts the policy to one instance per rule, on top of the parameters
+// of its nexthop. It has no side effects: use GenerateRadvdConfigFiles to render
+// the instances to disk.
+func Compile(policy *Policy, parameters []*Instance) ([]*Instance, error) {
+	instances := []*Instance{}
+	var errs []error
 	for _, i := range policy.Rules {
-		var new Instance
-		for _, j := range parameters {
-			if j.RouterID == i.Nexthop {
-				new = *j
-				break
-			}
+		k := slices.IndexFunc(parameters, func(p *Instance) bool { return p.RouterID == i.Nexthop })
+		if k < 0 {
+			errs = append(errs, fmt.Errorf("rule %d: nexthop %q is not a router of the parameters", i.ID, i.Nexthop))
+			continue
 		}
+		new := *parameters[k].Clone()
 		new.ID = uint32(i.ID)
 		if !is_contain(i.Prefixes, "::/0") {
 			for _, j := range i.Prefixes {
 				route := Route{
 					Route:              j,
-					AdvRouteLifetime:   1800,
-					AdvRoutePreference: "medium",
+					AdvRouteLifetime:   routeLifetime(i),
+					AdvRoutePreference: routePreference(i),
 				}
 				new.Routes = append(new.Routes, route)
 			}
-		} else if len(i.Prefixes) == 1 && i.Prefixes[0] == "::/0" {
-			// "::/0" must be the only element in the list
-			new.AdvDefaultPreference = "high"
+		}
+		if preference := defaultRouter(i); preference == "none" {
+			new.AdvDefaultLifetime = 0
+		} else {
+			new.AdvDefaultPreference = preference
+			if i.DefaultLifetime != nil {
+				new.AdvDefaultLifetime = *i.DefaultLifetime
+			}
 		}
 		instances = append(instances, &new)
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 
 	for _, i := range policy.Groups {
 		for _, j := range i.Rules {
 			for _, k := range instances {
 				if k.ID == uint32(j) {
 					k.Clients = append(k.Clients, i.Members...)
+					k.Dnssl = appendDnssl(k.Dnssl, i)
+					if err := applyNetworkOptions(k, i); err != nil {
+						return nil, err
+					}
 				}
 			}
 		}
 	}
 
+	// the rule options may not fit the intervals of the parameters
 	for _, i := range instances {
-		err := GenerateRadvdConfigFile(i, debugConfPath)
-		if err != nil {
-			return nil, err
+		for _, err := range i.Validate() {
+			errs = append(errs, fmt.Errorf("rule %d: %s", i.ID, err.Error()))
 		}
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 
 	return instances, nil
 }
 
-func LoadPolicyFile(filePath string) (*Policy, error) {
+func routeLifetime(rule Rule) uint32 {
+	if rule.RouteLifetime != nil {
+		return *rule.RouteLifetime
+	}
+	return 1800
+}
+
+func routePreference(rule Rule) string {
+	if rule.RoutePreference != "" {
+		return rule.RoutePreference
+	}
+	return "medium"
+}
+
+// defaultRouter is the preference of the router as a default router, or "none".
+func defaultRouter(rule Rule) string {
+	if rule.DefaultRouter != "" {
+		return rule.DefaultRouter
+	}
+	if isDefaultRule(rule) {
+		// "::/0" must be the only element in the list
+		return "high"
+	}
+	return "none"
+}
+
+// appendDnssl adds the search domains of the group. Groups that share a rule
+// share its radvd instance, so their domains are merged.
+func appendDnssl(dnssl []DNSSL, group Group) []DNSSL {
+	lifetime := group.DnsslLifetime
+	if lifetime == 0 {
+		lifetime = defaultDnsslLifetime
+	}
+	for _, domain := range group.Dnssl {
+		if !slices.ContainsFunc(dnssl, func(d DNSSL) bool { return d.Domain == domain }) {
+			dnssl = append(dnssl, DNSSL{Domain: domain, AdvDnsslLifetime: lifetime})
+		}
+	}
+	return dnssl
+}
+
+// applyNetworkOptions adds the NAT64 prefixes and the captive portal of the group.
+// Groups that share a rule must not have different captive portals.
+func applyNetworkOptions(instance *Instance, group Group) error {
+	for _, prefix := range group.Nat64Prefixes {
+		if !slices.ContainsFunc(instance.Nat64Prefixes, func(p NAT64Prefix) bool { return p.Prefix == prefix }) {
+			instance.Nat64Prefixes = append(instance.Nat64Prefixes, NAT64Prefix{Prefix: prefix})
+		}
+	}
+	if group.CaptivePortal == "" {
+		return nil
+	}
+	if instance.AdvCaptivePortalAPI != "" && instance.AdvCaptivePortalAPI != group.CaptivePortal {
+		return fmt.Errorf("group %d: rule %d already has the captive portal %q", group.ID, instance.ID, instance.AdvCaptivePortalAPI)
+	}
+	instance.AdvCaptivePortalAPI = group.CaptivePortal
+	return nil
+}
+
+// LoadPolicyFile reads and validates a policy. The nexthops are checked against
+// the parameters, and every violation is reported in a *PolicyError.
+func LoadPolicyFile(filePath string, parameters []*Instance) (*Policy, error) {
+	policy, err := readPolicyFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if violations := policy.Validate(parameters); len(violations) > 0 {
+		return nil, &PolicyError{File: filePath, Violations: violations}
+	}
+
+	return policy, nil
+}
+
+// readPolicyFile reads a policy and the lines of its paths, without validating it.
+func readPolicyFile(filePath string) (*Policy, error) {
 	fileData, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
+	var node yaml.Node
+	if err = yaml.Unmarshal(fileData, &node); err != nil {
+		return nil, err
+	}
 	var policy Policy
-	if err = yaml.Unmarshal(fileData, &policy); err != nil {
+	if err = node.Decode(&policy); err != nil {
 		return nil, err
 	}
-	// validate the rules
-	for _, i := range policy.Rules {
-		if err := policy.validateRule(i); err != nil {
-			return nil, err
+	policy.lines = map[string]int{}
+	yamlLines(&node, "", policy.lines)
+	return &policy, nil
+}
+
+// yamlLines records the line of each path of the document.
+func yamlLines(node *yaml.Node, path string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			yamlLines(n, path, lines)
 		}
-	}
-	// validate the group
-	for _, i := range policy.Groups {
-		if err := policy.validateGroup(i); err != nil {
-			return nil, err
+		return
+	case yaml.MappingNode:
+		for k := 0; k+1 < len(node.Content); k += 2 {
+			key := node.Content[k].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			yamlLines(node.Content[k+1], key, lines)
+			// a field is reported at its key, not at its value
+			lines[key] = node.Content[k].Line
+		}
+	case yaml.SequenceNode:
+		for k, n := range node.Content {
+			yamlLines(n, fmt.Sprintf("%s[%d]", path, k), lines)
 		}
 	}
-
-	return &policy, nil
+	lines[path] = node.Line
 }
 
-func LoadParameterFile() ([]*Instance, error) {
-	fileData, err := os.ReadFile(parameterFile)
+// LoadParameterFile reads the parameters of the routers, the instances that the
+// rules are compiled on top of, keyed by their router_id.
+func LoadParameterFile(filePath string) ([]*Instance, error) {
+	fileData, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
@@ -128,34 +271,119 @@ func LoadParameterFile() ([]*Instance, error) {
 
 type ValidationErrors = validator.ValidationErrors
 
-//var domainRegexp = regexp.MustCompile(`^(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9][a-z0-9-]{0,61}[a-z0-9]$`)
-
-func (c *Policy) validateRule(rule Rule) error {
-	// validate := validator.New(validator.WithRequiredStructEnabled())
+// PolicyViolation is a problem of a policy, at a path of the policy file.
+type PolicyViolation struct {
+	// Line is 0 for a policy that was not read from a file
+	Line    int
+	Path    string
+	Message string
+}
 
-	// TODO:
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%d: %s: %s", v.Line, v.Path, v.Message)
+}
 
-	return nil
+// PolicyError is returned by LoadPolicyFile with every violation of the policy.
+type PolicyError struct {
+	File       string
+	Violations []PolicyViolation
 }
 
-func (c *Policy) validateGroup(group Group) error {
-	validate := validator.New(validator.WithRequiredStructEnabled())
+func (e *PolicyError) Error() string {
+	var msgs []string
+	for _, v := range e.Violations {
+		msgs = append(msgs, fmt.Sprintf("%s:%s", e.File, v))
+	}
+	return strings.Join(msgs, "\n")
+}
 
-	validate.RegisterValidation("chechk_rule_exist", func(fl validator.FieldLevel) bool {
+// Validate checks the struct tags of the policy and its references: the rules of
+// the groups must exist and the nexthops must be routers of the parameters.
+func (c *Policy) Validate(parameters []*Instance) []PolicyViolation {
+	return c.validate(parameters, true)
+}
 
-		for _, i := range c.Rules {
-			for _, j := range group.Rules {
-				if i.ID == j {
-					return true
-				}
-			}
+// validate is Validate, without the check of the nexthops if checkNexthops is
+// false: LintPolicy reports them as LintUnknownNexthop.
+func (c *Policy) validate(parameters []*Instance, checkNexthops bool) []PolicyViolation {
+	var violations []PolicyViolation
+	err := newValidator("yaml").Struct(c)
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		for _, e := range verrs {
+			path := strings.TrimPrefix(e.Namespace(), "Policy.")
+			violations = append(violations, c.violation(path, validationMessage(e)))
 		}
-		return false
+	} else if err != nil {
+		violations = append(violations, c.violation("", err.Error()))
+	}
+	for n, rule := range c.Rules {
+		violations = append(violations, c.validateRule(n, rule, parameters, checkNexthops)...)
+	}
+	for n, group := range c.Groups {
+		violations = append(violations, c.validateGroup(n, group)...)
+	}
+	slices.SortStableFunc(violations, func(a, b PolicyViolation) int {
+		return a.Line - b.Line
 	})
+	return violations
+}
 
-	// TODO:
+// violation returns a violation at the line of path, or of its closest parent
+// for a field that is missing from the file.
+func (c *Policy) violation(path string, message string) PolicyViolation {
+	v := PolicyViolation{Path: path, Message: message}
+	for p := path; p != ""; {
+		if line, ok := c.lines[p]; ok {
+			v.Line = line
+			break
+		}
+		i := strings.LastIndexAny(p, ".[")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	if v.Path == "" {
+		v.Path = "."
+	}
+	return v
+}
 
-	return nil
+func (c *Policy) validateRule(n int, rule Rule, parameters []*Instance, checkNexthops bool) []PolicyViolation {
+	var violations []PolicyViolation
+	path := fmt.Sprintf("rules[%d]", n)
+	if k := slices.IndexFunc(c.Rules[:n], func(r Rule) bool { return r.ID == rule.ID }); k >= 0 && rule.ID != 0 {
+		violations = append(violations, c.violation(path+".id", fmt.Sprintf("id %d is already used by rules[%d]", rule.ID, k)))
+	}
+	if checkNexthops && rule.Nexthop != "" && !slices.ContainsFunc(parameters, func(i *Instance) bool { return i.RouterID == rule.Nexthop }) {
+		violations = append(violations, c.violation(path+".nexthop", fmt.Sprintf("%q is not a router_id of the parameters", rule.Nexthop)))
+	}
+	if rule.DefaultRouter == "none" && rule.DefaultLifetime != nil {
+		violations = append(violations, c.violation(path+".default_lifetime", `can not be set with default_router "none"`))
+	}
+	// "::/0" is advertised as the default route, which can not be combined with routes
+	if len(rule.Prefixes) > 1 {
+		for k, prefix := range rule.Prefixes {
+			if prefix == "::/0" {
+				violations = append(violations, c.violation(fmt.Sprintf("%s.prefixes[%d]", path, k), `"::/0" must be the only prefix of the rule`))
+			}
+		}
+	}
+	return violations
+}
+
+func (c *Policy) validateGroup(n int, group Group) []PolicyViolation {
+	var violations []PolicyViolation
+	if k := slices.IndexFunc(c.Groups[:n], func(g Group) bool { return g.ID == group.ID }); k >= 0 && group.ID != 0 {
+		violations = append(violations, c.violation(fmt.Sprintf("groups[%d].id", n), fmt.Sprintf("id %d is already used by groups[%d]", group.ID, k)))
+	}
+	for k, id := range group.Rules {
+		if !slices.ContainsFunc(c.Rules, func(r Rule) bool { return r.ID == id }) {
+			violations = append(violations, c.violation(fmt.Sprintf("groups[%d].rules[%d]", n, k), fmt.Sprintf("rule %d does not exist", id)))
+		}
+	}
+	return violations
 }
 
 func is_contain(slice []string, item string) bool {
@@ -0,0 +1,268 @@
+package radvd_manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testParameters() []*Instance {
+	router := func(id string) *Instance {
+		return &Instance{
+			RouterID:             id,
+			Name:                 "eth1",
+			AdvSendAdvert:        true,
+			MinRtrAdvInterval:    3,
+			MaxRtrAdvInterval:    10,
+			AdvDefaultLifetime:   1800,
+			AdvDefaultPreference: "medium",
+		}
+	}
+	return []*Instance{router("fc00:abcd::a"), router("fc00:abcd::b")}
+}
+
+// writePolicy writes the policy to a file in a directory without a parameter file.
+func writePolicy(t *testing.T, policy string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// chdir changes to an empty directory for the test, so that nothing can read parameter.default.yaml.
+func chdir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestLoadPolicyFileWithParameters(t *testing.T) {
+	example, err := os.ReadFile("policy.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writePolicy(t, string(example))
+	chdir(t)
+	policy, err := LoadPolicyFile(file, testParameters())
+	if err != nil {
+		t.Fatalf("LoadPolicyFile: %v", err)
+	}
+	if len(policy.Rules) != 4 || len(policy.Groups) != 2 {
+		t.Fatalf("got %d rules and %d groups", len(policy.Rules), len(policy.Groups))
+	}
+	if findings := LintPolicy(policy, testParameters()); len(findings) != 0 {
+		t.Fatalf("LintPolicy of the example: %v", findings)
+	}
+}
+
+func TestLoadPolicyFileViolations(t *testing.T) {
+	file := writePolicy(t, `rules:
+  - id: 1
+    prefixes: ["2001:db8:1::/64", "::/0"]
+    nexthop: "fc00:abcd::c"
+  - id: 1
+    prefixes: ["2001:db8:2::/64"]
+    nexthop: "fc00:abcd::a"
+    default_router: none
+    default_lifetime: 600
+groups:
+  - id: 100
+    rules: [1, 7]
+    members: ["ff02::1"]
+`)
+	_, err := LoadPolicyFile(file, testParameters())
+	perr, ok := err.(*PolicyError)
+	if !ok {
+		t.Fatalf("LoadPolicyFile = %v, want *PolicyError", err)
+	}
+	want := []string{
+		`3: rules[0].prefixes[1]: "::/0" must be the only prefix of the rule`,
+		`4: rules[0].nexthop: "fc00:abcd::c" is not a router_id of the parameters`,
+		`5: rules[1].id: id 1 is already used by rules[0]`,
+		`9: rules[1].default_lifetime: can not be set with default_router "none"`,
+		`12: groups[0].rules[1]: rule 7 does not exist`,
+		`13: groups[0].members[0]:`,
+	}
+	if len(perr.Violations) != len(want) {
+		t.Fatalf("got violations:\n%s", perr)
+	}
+	for n, v := range perr.Violations {
+		if !strings.HasPrefix(v.String(), want[n]) {
+			t.Errorf("violation %d = %q, want %q", n, v, want[n])
+		}
+	}
+	if !strings.HasPrefix(perr.Error(), file+":3: ") {
+		t.Errorf("error is not positioned in the file: %q", perr.Error())
+	}
+}
+
+func TestCompile(t *testing.T) {
+	policy := &Policy{
+		Rules: []Rule{
+			{ID: 1, Prefixes: []string{"2001:db8:1::/64"}, Nexthop: "fc00:abcd::a", RoutePreference: "high"},
+			{ID: 2, Prefixes: []string{"2001:db8:1::/64"}, Nexthop: "fc00:abcd::b", DefaultRouter: "low", DefaultLifetime: newValue(uint32(600))},
+			{ID: 998, Prefixes: []string{"::/0"}, Nexthop: "fc00:abcd::a"},
+		},
+		Groups: []Group{
+			{ID: 100, Rules: []int{1, 998}, Members: []string{"fe80::1"}, Dnssl: []string{"a.example.com"}},
+			{ID: 200, Rules: []int{2}, Members: []string{"fe80::2"}, Dnssl: []string{"b.example.com"}, DnsslLifetime: 600},
+		},
+	}
+	params := testParameters()
+	instances, err := Compile(policy, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 3 {
+		t.Fatalf("got %d instances", len(instances))
+	}
+	route, backup, def := instances[0], instances[1], instances[2]
+	if route.AdvDefaultLifetime != 0 {
+		t.Errorf("route-only rule is a default router: adv_default_lifetime = %d", route.AdvDefaultLifetime)
+	}
+	if len(route.Routes) != 1 || !reflect.DeepEqual(route.Routes[0], Route{Route: "2001:db8:1::/64", AdvRouteLifetime: 1800, AdvRoutePreference: "high"}) {
+		t.Errorf("routes = %+v", route.Routes)
+	}
+	if backup.AdvDefaultLifetime != 600 || backup.AdvDefaultPreference != "low" {
+		t.Errorf("default_router low: adv_default_lifetime = %d, adv_default_preference = %q", backup.AdvDefaultLifetime, backup.AdvDefaultPreference)
+	}
+	if len(def.Routes) != 0 || def.AdvDefaultLifetime != 1800 || def.AdvDefaultPreference != "high" {
+		t.Errorf("::/0 rule: %+v", def)
+	}
+	if len(def.Clients) != 1 || def.Clients[0] != "fe80::1" {
+		t.Errorf("clients = %v", def.Clients)
+	}
+	if len(backup.Dnssl) != 1 || !reflect.DeepEqual(backup.Dnssl[0], DNSSL{Domain: "b.example.com", AdvDnsslLifetime: 600}) {
+		t.Errorf("dnssl = %+v", backup.Dnssl)
+	}
+	// the parameters are not modified
+	if params[0].AdvDefaultLifetime != 1800 || len(params[0].Routes) != 0 || len(params[0].Clients) != 0 {
+		t.Errorf("Compile modified the parameters: %+v", params[0])
+	}
+
+	policy.Rules[0].Nexthop = "fc00:abcd::c"
+	if _, err := Compile(policy, params); err == nil || !strings.Contains(err.Error(), "rule 1: nexthop") {
+		t.Errorf("Compile with an unknown nexthop = %v", err)
+	}
+}
+
+func TestLintPolicy(t *testing.T) {
+	file := writePolicy(t, `rules:
+  - id: 1
+    prefixes: ["2001:db8:1::/64"]
+    nexthop: "fc00:abcd::a"
+  - id: 2
+    prefixes: ["2001:db8:1::/64"]
+    nexthop: "fc00:abcd::b"
+    default_router: none
+  - id: 3
+    prefixes: ["2001:db8:1:0:1::/80"]
+    nexthop: "fc00:abcd::b"
+    default_router: none
+  - id: 4
+    prefixes: ["::/0"]
+    nexthop: "fc00:abcd::a"
+  - id: 5
+    prefixes: ["::/0"]
+    nexthop: "fc00:abcd::b"
+groups:
+  - id: 100
+    rules: [1, 4, 5]
+    members: ["fe80::1"]
+  - id: 200
+    rules: [2]
+    members: ["fe80::1"]
+`)
+	chdir(t)
+	params := testParameters()
+	policy, err := LoadPolicyFile(file, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := map[string]int{}
+	for _, f := range LintPolicy(policy, params) {
+		codes[f.Code]++
+	}
+	want := map[string]int{
+		LintConflictingRoutes:     1,
+		LintDefaultRouters:        1,
+		LintUnusedRule:            1,
+		LintOverlappingPrefixes:   3,
+		LintImplicitDefaultRouter: 1,
+	}
+	for code, n := range want {
+		if codes[code] != n {
+			t.Errorf("%s: got %d findings, want %d (all: %v)", code, codes[code], n, codes)
+		}
+	}
+
+	// the nexthops are looked up in the given parameters only
+	if findings := LintPolicy(policy, params[:1]); !containsCode(findings, LintUnknownNexthop) {
+		t.Errorf("no %s without the parameters of fc00:abcd::b: %v", LintUnknownNexthop, findings)
+	}
+}
+
+func TestLintPolicyFile(t *testing.T) {
+	file := writePolicy(t, `rules:
+  - id: 1
+    prefixes: ["::/0"]
+    nexthop: "fc00:abcd::c"
+groups:
+  - id: 100
+    rules: [1]
+    members: ["fe80::1"]
+`)
+	findings, err := LintPolicyFile(file, testParameters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Code != LintUnknownNexthop || findings[0].Line != 4 || findings[0].Path != "rules[0].nexthop" {
+		t.Fatalf("LintPolicyFile of an unknown nexthop = %v, want one %s at line 4", findings, LintUnknownNexthop)
+	}
+	// LoadPolicyFile still rejects it
+	if _, err := LoadPolicyFile(file, testParameters()); err == nil {
+		t.Fatal("LoadPolicyFile accepted an unknown nexthop")
+	}
+
+	// the other violations are reported, and the policy is not linted
+	file = writePolicy(t, `rules:
+  - id: 1
+    prefixes: ["::/0"]
+    nexthop: "fc00:abcd::a"
+    default_router: always
+groups:
+  - id: 100
+    rules: [1]
+    members: ["fe80::1"]
+`)
+	findings, err = LintPolicyFile(file, testParameters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Code != LintInvalid || findings[0].Path != "rules[0].default_router" {
+		t.Fatalf("LintPolicyFile of an invalid policy = %v, want one %s", findings, LintInvalid)
+	}
+}
+
+func containsCode(findings []LintFinding, code string) bool {
+	for _, f := range findings {
+		if f.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func newValue[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,142 @@
+package radvd_manager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Executor runs radvd. The default OSExecutor runs real processes,
+// FakeExecutor emulates them so that the manager can be tested without root.
+type Executor interface {
+	// Run runs the command and waits for it to finish.
+	Run(name string, args ...string) error
+	// Output runs the command and returns its stdout and stderr.
+	Output(name string, args ...string) ([]byte, error)
+	// Start starts the command in the background. Its stdin, stdout and stderr are
+	// /dev/null, so that it keeps running when the manager exits.
+	Start(name string, args []string) (Process, error)
+	// Signal sends a signal to the process. Signal 0 checks that the process exists.
+	Signal(pid int, sig syscall.Signal) error
+	// Cmdline returns the command line of the process.
+	Cmdline(pid int) ([]string, error)
+}
+
+// Process is a process started by an Executor.
+type Process interface {
+	Pid() int
+	// Wait waits for the process to exit and returns its exit status.
+	Wait() error
+}
+
+// FileSystem is the subset of file operations used by the manager.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Remove(name string) error
+	Glob(pattern string) ([]string, error)
+}
+
+// Paths is the location of radvd and its files.
+type Paths struct {
+	Radvd       string `yaml:"radvd" validate:"required,file"`
+	ConfDir     string `yaml:"conf_dir" validate:"required,dir"`
+	PIDDir      string `yaml:"pid_dir" validate:"required,dir"`
+	DefaultConf string `yaml:"default_conf" validate:"required"`
+	// TemplateDir holds custom templates per router or interface, see Templates.
+	TemplateDir string `yaml:"template_dir" validate:"omitempty,dir"`
+}
+
+func DefaultPaths() Paths {
+	return Paths{
+		Radvd:       "/usr/sbin/radvd",
+		ConfDir:     RadvdConfPath,
+		PIDDir:      "/var/run/radvd/",
+		DefaultConf: defaultRadvdCondFile,
+	}
+}
+
+func (p Paths) ConfFile(id int) string {
+	return filepath.Join(p.ConfDir, strconv.Itoa(id)+".conf")
+}
+
+func (p Paths) PIDFile(id int) string {
+	return filepath.Join(p.PIDDir, "radvd."+strconv.Itoa(id)+".pid")
+}
+
+// LogFile is the file radvd logs to. It is not a pipe to the manager, which
+// radvd would fail to write to once a manager that left it running exits.
+func (p Paths) LogFile(id int) string {
+	return filepath.Join(p.PIDDir, "radvd."+strconv.Itoa(id)+".log")
+}
+
+// OSExecutor runs real processes.
+type OSExecutor struct{}
+
+func (OSExecutor) Run(name string, args ...string) error {
+	return exec.Command(name, args...).Run()
+}
+
+func (OSExecutor) Output(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+func (OSExecutor) Start(name string, args []string) (Process, error) {
+	cmd := exec.Command(name, args...)
+	// own process group, so that signals to the server do not reach radvd
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &osProcess{cmd: cmd}, nil
+}
+
+func (OSExecutor) Signal(pid int, sig syscall.Signal) error {
+	return syscall.Kill(pid, sig)
+}
+
+func (OSExecutor) Cmdline(pid int) ([]string, error) {
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"), nil
+}
+
+type osProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p *osProcess) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+func (p *osProcess) Wait() error {
+	if err := p.cmd.Wait(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s", p.cmd.ProcessState.String())
+}
+
+// OSFileSystem uses the real filesystem.
+type OSFileSystem struct{}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFileSystem) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
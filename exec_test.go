@@ -0,0 +1,34 @@
+package radvd_manager
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// radvd must not write to a pipe of the manager, which is closed once a
+// manager that left it running exits.
+func TestOSExecutorStartDetachesOutput(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("no /proc")
+	}
+	exec := OSExecutor{}
+	proc, err := exec.Start("/bin/sh", []string{"-c", "sleep 10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		exec.Signal(proc.Pid(), syscall.SIGKILL)
+		proc.Wait()
+	}()
+	for fd := 0; fd <= 2; fd++ {
+		target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", proc.Pid(), fd))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target != os.DevNull {
+			t.Errorf("fd %d of the child is %s, want %s", fd, target, os.DevNull)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package radvd_manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// NewFakeManager returns a Manager that emulates radvd in memory.
+// It needs neither root nor a radvd binary and is meant for tests.
+func NewFakeManager() (*RadvdManager, *FakeExecutor, *MemFS) {
+	fs := NewMemFS()
+	exec := NewFakeExecutor(fs)
+	paths := DefaultPaths()
+	fs.WriteFile(paths.DefaultConf, []byte("interface eth0 {\n    AdvSendAdvert on;\n};\n"), 0644)
+	return NewManager(exec, fs, paths, nil), exec, fs
+}
+
+// FakeExecutor emulates radvd. Started processes write their PID file and
+// log file into the MemFS, reload on SIGHUP and exit on SIGTERM or SIGKILL.
+type FakeExecutor struct {
+	// CheckConfig is called by "radvd --configtest" with the config file.
+	// The default accepts any config file that exists.
+	CheckConfig func(conf []byte) error
+	// Version is reported by "radvd --version". The default supports every option.
+	Version string
+
+	fs      *MemFS
+	mu      sync.Mutex
+	nextPID int
+	procs   map[int]*fakeProcess
+}
+
+type fakeProcess struct {
+	pid     int
+	args    []string
+	pidFile string
+	reloads int
+	exited  chan struct{}
+	status  error
+}
+
+func NewFakeExecutor(fs *MemFS) *FakeExecutor {
+	return &FakeExecutor{
+		fs:      fs,
+		nextPID: 1000,
+		procs:   make(map[int]*fakeProcess),
+	}
+}
+
+func (e *FakeExecutor) Run(name string, args ...string) error {
+	conf, configtest := "", false
+	for n, a := range args {
+		switch a {
+		case "-C":
+			if n+1 < len(args) {
+				conf = args[n+1]
+			}
+		case "--configtest":
+			configtest = true
+		}
+	}
+	if !configtest {
+		return fmt.Errorf("fake radvd: unsupported command: %s %v", name, args)
+	}
+	data, err := e.fs.ReadFile(conf)
+	if err != nil {
+		return fmt.Errorf("fake radvd: %w", err)
+	}
+	if e.CheckConfig != nil {
+		return e.CheckConfig(data)
+	}
+	return nil
+}
+
+func (e *FakeExecutor) Output(name string, args ...string) ([]byte, error) {
+	if len(args) != 1 || args[0] != "--version" {
+		return nil, fmt.Errorf("fake radvd: unsupported command: %s %v", name, args)
+	}
+	version := e.Version
+	if version == "" {
+		version = "2.20"
+	}
+	return []byte("Version " + version + "\n"), nil
+}
+
+func (e *FakeExecutor) Start(name string, args []string) (Process, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextPID++
+	p := &fakeProcess{
+		pid:    e.nextPID,
+		args:   append([]string{name}, args...),
+		exited: make(chan struct{}),
+	}
+	logFile := ""
+	for n, a := range args {
+		if n+1 >= len(args) {
+			break
+		}
+		switch a {
+		case "-p":
+			p.pidFile = args[n+1]
+		case "-l":
+			logFile = args[n+1]
+		}
+	}
+	if p.pidFile != "" {
+		e.fs.WriteFile(p.pidFile, []byte(strconv.Itoa(p.pid)+"\n"), 0644)
+	}
+	if logFile != "" {
+		log, _ := e.fs.ReadFile(logFile)
+		log = fmt.Appendf(log, "fake radvd started (pid: %d)\n", p.pid)
+		e.fs.WriteFile(logFile, log, 0644)
+	}
+	e.procs[p.pid] = p
+	return p, nil
+}
+
+func (e *FakeExecutor) Signal(pid int, sig syscall.Signal) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.procs[pid]
+	if !ok {
+		return syscall.ESRCH
+	}
+	switch sig {
+	case 0:
+	case syscall.SIGHUP:
+		p.reloads++
+	case syscall.SIGTERM, syscall.SIGKILL:
+		e.exit(p, fmt.Errorf("signal: %s", sig))
+	default:
+		return fmt.Errorf("fake radvd: unsupported signal: %s", sig)
+	}
+	return nil
+}
+
+func (e *FakeExecutor) Cmdline(pid int) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.procs[pid]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return append([]string(nil), p.args...), nil
+}
+
+// Crash makes the process exit as if radvd crashed.
+func (e *FakeExecutor) Crash(pid int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.procs[pid]
+	if !ok {
+		return syscall.ESRCH
+	}
+	e.exit(p, errors.New("exit status 1"))
+	return nil
+}
+
+// Reloads returns how many times the process received SIGHUP.
+func (e *FakeExecutor) Reloads(pid int) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if p, ok := e.procs[pid]; ok {
+		return p.reloads
+	}
+	return 0
+}
+
+// Running returns the PIDs of the running processes.
+func (e *FakeExecutor) Running() []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	pids := make([]int, 0, len(e.procs))
+	for pid := range e.procs {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// exit must be called with e.mu held.
+func (e *FakeExecutor) exit(p *fakeProcess, status error) {
+	delete(e.procs, p.pid)
+	p.status = status
+	close(p.exited)
+}
+
+func (p *fakeProcess) Pid() int {
+	return p.pid
+}
+
+func (p *fakeProcess) Wait() error {
+	<-p.exited
+	return p.status
+}
+
+// MemFS is an in-memory FileSystem.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string][]byte)}
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[filepath.Clean(name)] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[filepath.Clean(name)]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, filepath.Clean(name))
+	return nil
+}
+
+func (m *MemFS) Glob(pattern string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matches []string
+	for name := range m.files {
+		ok, err := filepath.Match(pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
@@ -1,25 +1,198 @@
 package radvd_manager
 
 import (
+	"bytes"
+	_ "embed"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"text/template"
+	"text/template/parse"
 )
 
+//go:embed templates/radvd.template.conf
+var radvdTemplate string
+
+// DefaultTemplate is the template custom templates are based on (templates/radvd.template.conf).
+// It defines the blocks "options", "extra", "prefixes", "rdnss", "dnssl", "nat64", "routes" and "clients".
+var DefaultTemplate = radvdTemplate
+
+const (
+	defaultTemplateName = "radvd"
+	templateExt         = ".tmpl"
+	// fallbackTemplate is used for instances without a router or interface template.
+	fallbackTemplate = "default" + templateExt
+)
+
+var defaultTemplate = template.Must(template.New(defaultTemplateName).Funcs(template.FuncMap{"onoff": onOff}).Parse(radvdTemplate))
+
+// RenderRadvdConfig renders the radvd config of the instance.
+func RenderRadvdConfig(i *Instance) ([]byte, error) {
+	return MarshalRadvdConfig(i)
+}
+
 func GenerateRadvdConfigFile(i *Instance, filePath string) error {
-	tmpl, err := template.ParseFiles(templateFile)
+	conf, err := RenderRadvdConfig(i)
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %v", err)
+		return err
 	}
-	conf, err := os.Create(filePath + strconv.Itoa(int(i.ID)) + ".conf")
-	if err != nil {
+	if err := os.WriteFile(filePath+strconv.Itoa(int(i.ID))+".conf", conf, 0644); err != nil {
 		return fmt.Errorf("failed to create file: %v", err)
 	}
-	defer conf.Close()
-	if err = tmpl.Execute(conf, i); err != nil {
-		return fmt.Errorf("failed to execute template: %v", err)
+
+	return nil
+}
+
+// GenerateRadvdConfigFiles renders the instances to <dir>/<ID>.conf.
+func GenerateRadvdConfigFiles(instances []*Instance, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	for _, i := range instances {
+		conf, err := RenderRadvdConfig(i)
+		if err != nil {
+			return fmt.Errorf("failed to render instance %d: %v", i.ID, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(int(i.ID))+".conf"), conf, 0644); err != nil {
+			return fmt.Errorf("failed to create file: %v", err)
+		}
+	}
+	return nil
+}
+
+// Templates are the custom templates of a template directory.
+// The template of an instance is <RouterID>.tmpl, <Name>.tmpl or default.tmpl,
+// in this order. Instances without a template are written by MarshalRadvdConfig.
+//
+// A template is parsed on top of DefaultTemplate: a file that only redefines
+// some of its blocks, e.g. {{define "extra"}}, keeps the rest of the default.
+type Templates struct {
+	templates map[string]*template.Template
+}
+
+// LoadTemplates parses every template in the directory and renders it once
+// with a sample instance, so that broken templates are reported on startup.
+func LoadTemplates(dir string) (*Templates, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+templateExt))
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{templates: make(map[string]*template.Template)}
+	var errs []string
+	for _, file := range files {
+		name := filepath.Base(file)
+		key := strings.TrimSuffix(name, templateExt)
+		if name != fallbackTemplate && !isAddr6(key) && !ifnameRegexp.MatchString(key) {
+			errs = append(errs, fmt.Sprintf("%s: %q is neither a router ID nor an interface name", file, key))
+			continue
+		}
+		tmpl, err := parseTemplate(file)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := tmpl.Execute(&bytes.Buffer{}, sampleInstance()); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to execute template: %v", err))
+			continue
+		}
+		t.templates[name] = tmpl
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid templates in %s:\n  %s", dir, strings.Join(errs, "\n  "))
 	}
 
+	return t, nil
+}
+
+func parseTemplate(file string) (*template.Template, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %v", err)
+	}
+	base, err := defaultTemplate.Clone()
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(file)
+	tmpl, err := base.New(name).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %v", err)
+	}
+	// a file with only block definitions renders the default template
+	if tmpl.Tree == nil || parse.IsEmptyTree(tmpl.Tree.Root) {
+		return tmpl.Lookup(defaultTemplateName), nil
+	}
+	return tmpl, nil
+}
+
+// Lookup returns the template of the instance, or nil if there is none.
+func (t *Templates) Lookup(i *Instance) *template.Template {
+	if t == nil {
+		return nil
+	}
+	for _, name := range []string{i.RouterID + templateExt, i.Name + templateExt, fallbackTemplate} {
+		if tmpl, ok := t.templates[name]; ok && name != templateExt {
+			return tmpl
+		}
+	}
 	return nil
 }
+
+// Render renders the radvd config of the instance with its template, or
+// with MarshalRadvdConfig if it has none. The values are checked in the same
+// way in both cases, so that they can not inject directives into a template.
+func (t *Templates) Render(i *Instance) ([]byte, error) {
+	tmpl := t.Lookup(i)
+	if tmpl == nil {
+		return MarshalRadvdConfig(i)
+	}
+	if err := checkTokens(i); err != nil {
+		return nil, err
+	}
+	var conf bytes.Buffer
+	if err := tmpl.Execute(&conf, i); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	return conf.Bytes(), nil
+}
+
+// sampleInstance uses every field, so that templates are fully exercised on load.
+func sampleInstance() *Instance {
+	on, mtu, hopLimit, lifetime, delay := true, uint32(1500), uint32(64), uint32(3600), 3.0
+	return &Instance{
+		ID:                    1,
+		RouterID:              "2001:db8::1",
+		Name:                  "eth0",
+		AdvSendAdvert:         true,
+		MinRtrAdvInterval:     3,
+		MaxRtrAdvInterval:     10,
+		AdvDefaultLifetime:    30,
+		AdvDefaultPreference:  "medium",
+		Prefixes:              []Prefix{{Prefix: "2001:db8:1::/64", AdvOnLink: true, AdvAutonomous: true, AdvValidLifetime: 86400, AdvPreferredLifetime: &lifetime, DeprecatePrefix: &on, DecrementLifetimes: &on}},
+		Rdnss:                 []RDNSS{{Address: "2001:db8::53", AdvRdnssLifetime: 30, FlushRDNSS: &on}},
+		Dnssl:                 []DNSSL{{Domain: "example.com", AdvDnsslLifetime: 30, FlushDNSSL: &on}},
+		Routes:                []Route{{Route: "2001:db8:2::/48", AdvRouteLifetime: 300, AdvRoutePreference: "high", RemoveRoute: &on}},
+		Clients:               []string{"fe80::1"},
+		AdvLinkMTU:            &mtu,
+		AdvCurHopLimit:        &hopLimit,
+		AdvReachableTime:      &lifetime,
+		AdvRetransTimer:       &lifetime,
+		AdvSourceLLAddress:    &on,
+		UnicastOnly:           &on,
+		AdvRASolicitedUnicast: &on,
+		IgnoreIfMissing:       &on,
+		MinDelayBetweenRAs:    &delay,
+		AdvRASrcAddress:       []string{"fe80::1"},
+		AdvHomeAgentFlag:      &on,
+		AdvHomeAgentInfo:      &on,
+		HomeAgentLifetime:     &lifetime,
+		HomeAgentPreference:   &hopLimit,
+		AdvMobRtrSupportFlag:  &on,
+		AdvIntervalOpt:        &on,
+		Nat64Prefixes:         []NAT64Prefix{{Prefix: "64:ff9b::/96", AdvValidLifetime: &lifetime}},
+		AdvCaptivePortalAPI:   "https://example.com/api",
+	}
+}
@@ -0,0 +1,92 @@
+package radvd_manager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplates writes the templates, keyed by file name, to a temporary directory.
+func writeTemplates(t *testing.T, templates map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range templates {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTemplatesLookup(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"fc00:abcd::a.tmpl": `{{define "extra"}}# router template{{end}}`,
+		"eth2.tmpl":         `{{define "extra"}}# interface template{{end}}`,
+		"default.tmpl":      `{{define "extra"}}# default template{{end}}`,
+	})
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		routerID string
+		name     string
+		want     string
+	}{
+		{"fc00:abcd::a", "eth2", "# router template"},
+		{"fc00:abcd::a", "eth3", "# router template"},
+		{"fc00:abcd::b", "eth2", "# interface template"},
+		{"fc00:abcd::b", "eth3", "# default template"},
+		{"", "eth3", "# default template"},
+	} {
+		i := &Instance{ID: 1, RouterID: c.routerID, Name: c.name, AdvSendAdvert: true}
+		conf, err := templates.Render(i)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", c.routerID, c.name, err)
+		}
+		if !strings.Contains(string(conf), c.want) {
+			t.Errorf("%s/%s: rendered with\n%s\nwant %q", c.routerID, c.name, conf, c.want)
+		}
+		// the rest of the default template is kept
+		if got, err := parseRadvdConf("1.conf", conf, 1); err != nil || !got.Equal(i) {
+			t.Errorf("%s/%s: parse of\n%s\n= %+v, %v", c.routerID, c.name, conf, got, err)
+		}
+	}
+}
+
+func TestTemplatesWithoutDefault(t *testing.T) {
+	templates, err := LoadTemplates(writeTemplates(t, map[string]string{
+		"eth2.tmpl": `{{define "extra"}}# interface template{{end}}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if templates.Lookup(&Instance{Name: "eth3"}) != nil {
+		t.Fatal("an instance without a template got one")
+	}
+	// an empty router ID does not select ".tmpl"
+	if templates.Lookup(&Instance{Name: "eth2"}) == nil {
+		t.Fatal("the interface template was not selected")
+	}
+	var none *Templates
+	if none.Lookup(&Instance{Name: "eth2"}) != nil {
+		t.Fatal("nil templates returned a template")
+	}
+}
+
+func TestLoadTemplatesBroken(t *testing.T) {
+	for name, templates := range map[string]map[string]string{
+		"syntax error":    {"default.tmpl": `{{define "extra"}}{{end`},
+		"execution error": {"eth2.tmpl": `{{define "extra"}}{{.NoSuchField}}{{end}}`},
+		"unknown block":   {"eth2.tmpl": `{{template "nosuchblock"}}`},
+		"file name":       {"eth 2.tmpl": `{{define "extra"}}{{end}}`},
+	} {
+		dir := writeTemplates(t, templates)
+		if _, err := LoadTemplates(dir); err == nil {
+			t.Errorf("%s: LoadTemplates succeeded", name)
+		} else if !strings.Contains(err.Error(), dir) {
+			t.Errorf("%s: error %q does not name the template directory", name, err)
+		}
+	}
+}
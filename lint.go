@@ -0,0 +1,221 @@
+package radvd_manager
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// Codes of the lint findings. They are stable, so that they can be referenced
+// by hooks and documentation.
+const (
+	// LintInvalid is a violation reported by Policy.Validate
+	LintInvalid = "PL000"
+	// LintConflictingRoutes is a member that gets a prefix from different
+	// nexthops at the same preference
+	LintConflictingRoutes = "PL001"
+	// LintDefaultRouters is a group that references rules of different routers
+	// that advertise a default router at the same preference
+	LintDefaultRouters = "PL002"
+	// LintUnusedRule is a rule that no group references
+	LintUnusedRule = "PL003"
+	// LintOverlappingPrefixes is a prefix that overlaps a prefix of another rule
+	LintOverlappingPrefixes = "PL004"
+	// LintUnknownNexthop is a nexthop without an entry in the parameters
+	LintUnknownNexthop = "PL005"
+	// LintImplicitDefaultRouter is a rule without "::/0" and default_router
+	// whose router was a default router before default_router was introduced
+	LintImplicitDefaultRouter = "PL006"
+)
+
+// LintFinding is a semantic problem of a policy.
+type LintFinding struct {
+	Code     string       `json:"code"`
+	Severity LintSeverity `json:"severity"`
+	Line     int          `json:"line,omitempty"`
+	Path     string       `json:"path"`
+	Message  string       `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%d: %s %s: %s: %s", f.Line, f.Severity, f.Code, f.Path, f.Message)
+}
+
+// LintPolicyFile reads a policy and lints it. A policy that is invalid is not
+// linted: its violations are reported as LintInvalid findings, except for the
+// nexthops without parameters, which are reported as LintUnknownNexthop.
+func LintPolicyFile(filePath string, parameters []*Instance) ([]LintFinding, error) {
+	policy, err := readPolicyFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var findings []LintFinding
+	for _, v := range policy.validate(parameters, false) {
+		findings = append(findings, LintFinding{Code: LintInvalid, Severity: LintError, Line: v.Line, Path: v.Path, Message: v.Message})
+	}
+	if findings != nil {
+		return findings, nil
+	}
+	return LintPolicy(policy, parameters), nil
+}
+
+// LintPolicy reports the configuration of a valid policy that is conflicting
+// or dead. The nexthops are looked up in the parameters.
+func LintPolicy(policy *Policy, parameters []*Instance) []LintFinding {
+	var findings []LintFinding
+	add := func(code string, severity LintSeverity, path string, format string, a ...any) {
+		v := policy.violation(path, fmt.Sprintf(format, a...))
+		findings = append(findings, LintFinding{Code: code, Severity: severity, Line: v.Line, Path: v.Path, Message: v.Message})
+	}
+
+	for n, rule := range policy.Rules {
+		k := slices.IndexFunc(parameters, func(i *Instance) bool { return i.RouterID == rule.Nexthop })
+		if k < 0 {
+			add(LintUnknownNexthop, LintError, fmt.Sprintf("rules[%d].nexthop", n), "%q has no entry in the parameters", rule.Nexthop)
+			continue
+		}
+		if rule.DefaultRouter == "" && !isDefaultRule(rule) && parameters[k].AdvDefaultLifetime != 0 {
+			add(LintImplicitDefaultRouter, LintWarning, fmt.Sprintf("rules[%d]", n),
+				"rule %d no longer advertises %s as a default router (adv_default_lifetime %d of the parameters), set default_router to keep it or to \"none\" to silence this",
+				rule.ID, rule.Nexthop, parameters[k].AdvDefaultLifetime)
+		}
+	}
+
+	for n, rule := range policy.Rules {
+		if !slices.ContainsFunc(policy.Groups, func(g Group) bool { return slices.Contains(g.Rules, rule.ID) }) {
+			add(LintUnusedRule, LintWarning, fmt.Sprintf("rules[%d]", n), "rule %d is not used by any group", rule.ID)
+		}
+	}
+
+	for n, rule := range policy.Rules {
+		for _, other := range policy.Rules[:n] {
+			for k, prefix := range rule.Prefixes {
+				p, err := netip.ParsePrefix(prefix)
+				if err != nil || p.Bits() == 0 {
+					continue
+				}
+				for _, o := range other.Prefixes {
+					q, err := netip.ParsePrefix(o)
+					if err != nil || q.Bits() == 0 || !p.Overlaps(q) {
+						continue
+					}
+					path := fmt.Sprintf("rules[%d].prefixes[%d]", n, k)
+					if p.Masked() == q.Masked() {
+						if routePreference(rule) != routePreference(other) {
+							// a primary and a backup route
+							continue
+						}
+						add(LintOverlappingPrefixes, LintWarning, path, "%s is also a prefix of rule %d", prefix, other.ID)
+						continue
+					}
+					add(LintOverlappingPrefixes, LintWarning, path, "%s overlaps %s of rule %d", prefix, o, other.ID)
+				}
+			}
+		}
+	}
+
+	for n, group := range policy.Groups {
+		var defaults []Rule
+		for _, id := range group.Rules {
+			rule, ok := policy.rule(id)
+			if !ok || defaultRouter(rule) == "none" {
+				continue
+			}
+			// a backup default router at a lower preference is fine
+			k := slices.IndexFunc(defaults, func(r Rule) bool {
+				return r.Nexthop != rule.Nexthop && defaultRouter(r) == defaultRouter(rule)
+			})
+			if k >= 0 {
+				add(LintDefaultRouters, LintError, fmt.Sprintf("groups[%d].rules", n), "rules %d and %d both advertise a default router at the same preference, on %s and %s", defaults[k].ID, rule.ID, defaults[k].Nexthop, rule.Nexthop)
+				break
+			}
+			defaults = append(defaults, rule)
+		}
+	}
+
+	findings = append(findings, policy.lintConflictingRoutes()...)
+
+	slices.SortStableFunc(findings, func(a, b LintFinding) int {
+		return a.Line - b.Line
+	})
+	return findings
+}
+
+// lintConflictingRoutes reports the members that are in two groups whose rules
+// send the same prefix to different nexthops at the same preference.
+func (c *Policy) lintConflictingRoutes() []LintFinding {
+	type route struct {
+		prefix netip.Prefix
+		rule   Rule
+		group  Group
+	}
+	var findings []LintFinding
+	seen := map[string]bool{}
+	routes := map[netip.Addr][]route{}
+	for n, group := range c.Groups {
+		for k, member := range group.Members {
+			addr, err := netip.ParseAddr(member)
+			if err != nil {
+				continue
+			}
+			for _, id := range group.Rules {
+				rule, ok := c.rule(id)
+				if !ok {
+					continue
+				}
+				for _, prefix := range rule.Prefixes {
+					p, err := netip.ParsePrefix(prefix)
+					if err != nil {
+						continue
+					}
+					p = p.Masked()
+					for _, r := range routes[addr] {
+						if r.group.ID == group.ID || r.prefix != p || r.rule.Nexthop == rule.Nexthop ||
+							prefixPreference(r.rule, p) != prefixPreference(rule, p) {
+							continue
+						}
+						key := fmt.Sprintf("%s %s %d %d", addr, p, r.rule.ID, rule.ID)
+						if seen[key] {
+							continue
+						}
+						seen[key] = true
+						v := c.violation(fmt.Sprintf("groups[%d].members[%d]", n, k), fmt.Sprintf(
+							"%s gets %s from %s (rule %d, group %d) and %s (rule %d, group %d) at the same preference",
+							member, p, r.rule.Nexthop, r.rule.ID, r.group.ID, rule.Nexthop, rule.ID, group.ID))
+						findings = append(findings, LintFinding{Code: LintConflictingRoutes, Severity: LintError, Line: v.Line, Path: v.Path, Message: v.Message})
+					}
+					routes[addr] = append(routes[addr], route{p, rule, group})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+func (c *Policy) rule(id int) (Rule, bool) {
+	k := slices.IndexFunc(c.Rules, func(r Rule) bool { return r.ID == id })
+	if k < 0 {
+		return Rule{}, false
+	}
+	return c.Rules[k], true
+}
+
+// isDefaultRule reports whether the rule advertises the router as the default router.
+func isDefaultRule(rule Rule) bool {
+	return len(rule.Prefixes) == 1 && rule.Prefixes[0] == "::/0"
+}
+
+// prefixPreference is the preference of the route of a prefix of the rule, as set by Compile.
+func prefixPreference(rule Rule, prefix netip.Prefix) string {
+	if prefix.Bits() == 0 {
+		return defaultRouter(rule)
+	}
+	return routePreference(rule)
+}
@@ -6,12 +6,15 @@
 package radvd_manager
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 )
 
@@ -20,138 +23,508 @@ type Instance struct {
 	// Metadata
 	ID       uint32 `json:"id" yaml:"id"`
 	PID      uint32 `json:"pid" yaml:"pid"`
-	RouterID string `json:"router_id" yaml:"router_id"`
-	Name     string `json:"name" yaml:"name"`
+	RouterID string `json:"router_id" yaml:"router_id" validate:"omitempty,ipv6"`
+	Name     string `json:"name" yaml:"name" validate:"required,ifname"`
 	// Configuration parameters for radvd
 	AdvSendAdvert        bool     `json:"adv_send_advert" yaml:"adv_send_advert"`
-	MinRtrAdvInterval    uint32   `json:"min_rtr_adv_interval" yaml:"min_rtr_adv_interval"`
-	MaxRtrAdvInterval    uint32   `json:"max_rtr_adv_interval" yaml:"max_rtr_adv_interval"`
+	MinRtrAdvInterval    uint32   `json:"min_rtr_adv_interval" yaml:"min_rtr_adv_interval" validate:"omitempty,min=3,max=1350"`
+	MaxRtrAdvInterval    uint32   `json:"max_rtr_adv_interval" yaml:"max_rtr_adv_interval" validate:"omitempty,min=4,max=1800"`
 	AdvManagedFlag       bool     `json:"adv_managed_flag" yaml:"adv_managed_flag"`
 	AdvOtherConfigFlag   bool     `json:"adv_other_config_flag" yaml:"adv_other_config_flag"`
-	AdvDefaultLifetime   uint32   `json:"adv_default_lifetime" yaml:"adv_default_lifetime"`
-	AdvDefaultPreference string   `json:"adv_default_preference" yaml:"adv_default_preference"`
-	Prefixes             []Prefix `json:"prefixes" yaml:"prefixes"`
-	Rdnss                []RDNSS  `json:"rdnss" yaml:"rdnss"`
-	Routes               []Route  `json:"routes" yaml:"routes"`
-	Clients              []string `json:"clients" yaml:"clients"`
+	AdvDefaultLifetime   uint32   `json:"adv_default_lifetime" yaml:"adv_default_lifetime" validate:"max=9000"`
+	AdvDefaultPreference string   `json:"adv_default_preference" yaml:"adv_default_preference" validate:"omitempty,oneof=low medium high"`
+	Prefixes             []Prefix `json:"prefixes" yaml:"prefixes" validate:"dive"`
+	Rdnss                []RDNSS  `json:"rdnss" yaml:"rdnss" validate:"dive"`
+	Dnssl                []DNSSL  `json:"dnssl" yaml:"dnssl" validate:"dive"`
+	Routes               []Route  `json:"routes" yaml:"routes" validate:"dive"`
+	Clients              []string `json:"clients" yaml:"clients" validate:"dive,unicast6"`
+	// Optional parameters for radvd, nil is not written and leaves the default of radvd
+	AdvLinkMTU            *uint32  `json:"adv_link_mtu,omitempty" yaml:"adv_link_mtu,omitempty" validate:"omitempty,eq=0|min=1280"`
+	AdvCurHopLimit        *uint32  `json:"adv_cur_hop_limit,omitempty" yaml:"adv_cur_hop_limit,omitempty" validate:"omitempty,max=255"`
+	AdvReachableTime      *uint32  `json:"adv_reachable_time,omitempty" yaml:"adv_reachable_time,omitempty" validate:"omitempty,max=3600000"`
+	AdvRetransTimer       *uint32  `json:"adv_retrans_timer,omitempty" yaml:"adv_retrans_timer,omitempty"`
+	AdvSourceLLAddress    *bool    `json:"adv_source_ll_address,omitempty" yaml:"adv_source_ll_address,omitempty"`
+	UnicastOnly           *bool    `json:"unicast_only,omitempty" yaml:"unicast_only,omitempty"`
+	AdvRASolicitedUnicast *bool    `json:"adv_ra_solicited_unicast,omitempty" yaml:"adv_ra_solicited_unicast,omitempty"`
+	IgnoreIfMissing       *bool    `json:"ignore_if_missing,omitempty" yaml:"ignore_if_missing,omitempty"`
+	MinDelayBetweenRAs    *float64 `json:"min_delay_between_ras,omitempty" yaml:"min_delay_between_ras,omitempty" validate:"omitempty,min=0"`
+	AdvRASrcAddress       []string `json:"adv_ra_src_address,omitempty" yaml:"adv_ra_src_address,omitempty" validate:"dive,unicast6"`
+	// Mobile IPv6 (RFC 6275)
+	AdvHomeAgentFlag     *bool   `json:"adv_home_agent_flag,omitempty" yaml:"adv_home_agent_flag,omitempty"`
+	AdvHomeAgentInfo     *bool   `json:"adv_home_agent_info,omitempty" yaml:"adv_home_agent_info,omitempty"`
+	HomeAgentLifetime    *uint32 `json:"home_agent_lifetime,omitempty" yaml:"home_agent_lifetime,omitempty" validate:"omitempty,max=65520"`
+	HomeAgentPreference  *uint32 `json:"home_agent_preference,omitempty" yaml:"home_agent_preference,omitempty" validate:"omitempty,max=65535"`
+	AdvMobRtrSupportFlag *bool   `json:"adv_mob_rtr_support_flag,omitempty" yaml:"adv_mob_rtr_support_flag,omitempty"`
+	AdvIntervalOpt       *bool   `json:"adv_interval_opt,omitempty" yaml:"adv_interval_opt,omitempty"`
+	// PREF64 (RFC 8781) and captive portal (RFC 8910), they need a recent radvd, see RadvdVersion
+	Nat64Prefixes       []NAT64Prefix `json:"nat64_prefixes,omitempty" yaml:"nat64_prefixes,omitempty" validate:"dive"`
+	AdvCaptivePortalAPI string        `json:"adv_captive_portal_api,omitempty" yaml:"adv_captive_portal_api,omitempty" validate:"omitempty,captiveportal"`
+	// Extra are the directives of the interface block that are not modelled, kept verbatim.
+	Extra []string `json:"extra,omitempty" yaml:"extra,omitempty"`
+	// OtherInterfaces are the interface blocks of /etc/radvd.conf after the
+	// first one, kept verbatim. Only the default instance (id: 0) has them.
+	OtherInterfaces []string `json:"other_interfaces,omitempty" yaml:"-"`
+	// Runtime status reported by the supervisor
+	State      string   `json:"state,omitempty" yaml:"-"`
+	Restarts   uint32   `json:"restarts,omitempty" yaml:"-"`
+	LastExit   string   `json:"last_exit,omitempty" yaml:"-"`
+	LastStderr []string `json:"last_stderr,omitempty" yaml:"-"`
 }
 
 type Prefix struct {
-	Prefix           string `json:"prefix" yaml:"prefix"`
+	Prefix           string `json:"prefix" yaml:"prefix" validate:"required,cidrv6"`
 	AdvOnLink        bool   `json:"adv_on_link" yaml:"adv_on_link"`
 	AdvAutonomous    bool   `json:"adv_autonomous" yaml:"adv_autonomous"`
 	AdvRouterAddr    bool   `json:"adv_router_addr" yaml:"adv_router_addr"`
 	AdvValidLifetime uint32 `json:"adv_valid_lifetime" yaml:"adv_valid_lifetime"`
+	// Optional, nil leaves the default of radvd
+	AdvPreferredLifetime *uint32  `json:"adv_preferred_lifetime,omitempty" yaml:"adv_preferred_lifetime,omitempty"`
+	DeprecatePrefix      *bool    `json:"deprecate_prefix,omitempty" yaml:"deprecate_prefix,omitempty"`
+	DecrementLifetimes   *bool    `json:"decrement_lifetimes,omitempty" yaml:"decrement_lifetimes,omitempty"`
+	Extra                []string `json:"extra,omitempty" yaml:"extra,omitempty"`
 }
 
 type RDNSS struct {
-	Address          string `json:"address" yaml:"address"`
-	AdvRdnssLifetime uint32 `json:"adv_rdnss_lifetime" yaml:"adv_rdnss_lifetime"`
+	Address          string   `json:"address" yaml:"address" validate:"required,ipv6"`
+	AdvRdnssLifetime uint32   `json:"adv_rdnss_lifetime" yaml:"adv_rdnss_lifetime"`
+	FlushRDNSS       *bool    `json:"flush_rdnss,omitempty" yaml:"flush_rdnss,omitempty"`
+	Extra            []string `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+// DNSSL is a DNS search domain (RFC 8106).
+type DNSSL struct {
+	Domain           string   `json:"domain" yaml:"domain" validate:"required,domain"`
+	AdvDnsslLifetime uint32   `json:"adv_dnssl_lifetime" yaml:"adv_dnssl_lifetime"`
+	FlushDNSSL       *bool    `json:"flush_dnssl,omitempty" yaml:"flush_dnssl,omitempty"`
+	Extra            []string `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+// NAT64Prefix is the PREF64 option (RFC 8781), the NAT64 prefix of the network.
+type NAT64Prefix struct {
+	Prefix           string   `json:"prefix" yaml:"prefix" validate:"required,pref64"`
+	AdvValidLifetime *uint32  `json:"adv_valid_lifetime,omitempty" yaml:"adv_valid_lifetime,omitempty" validate:"omitempty,max=65528"`
+	Extra            []string `json:"extra,omitempty" yaml:"extra,omitempty"`
 }
 
 type Route struct {
-	Route              string `json:"route" yaml:"route"`
-	AdvRouteLifetime   uint32 `json:"adv_route_lifetime" yaml:"adv_route_lifetime"`
-	AdvRoutePreference string `json:"adv_route_preference" yaml:"adv_route_preference"`
+	Route              string   `json:"route" yaml:"route" validate:"required,cidrv6"`
+	AdvRouteLifetime   uint32   `json:"adv_route_lifetime" yaml:"adv_route_lifetime"`
+	AdvRoutePreference string   `json:"adv_route_preference" yaml:"adv_route_preference" validate:"omitempty,oneof=low medium high"`
+	RemoveRoute        *bool    `json:"remove_route,omitempty" yaml:"remove_route,omitempty"`
+	Extra              []string `json:"extra,omitempty" yaml:"extra,omitempty"`
 }
 
-func CheckRadvdConfig(id int) error {
-	cmd := exec.Command(
-		"/usr/sbin/radvd",
-		"-C", fmt.Sprintf("/etc/radvd.d/%d.conf", id),
-		"--configtest",
-	)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failt to check configure: %w", err)
+// Equal reports whether two instances have the same configuration.
+// Runtime information such as PID and State is ignored.
+func (i *Instance) Equal(o *Instance) bool {
+	if i == nil || o == nil {
+		return i == o
 	}
-	return nil
+	a, b := i.normalize(), o.normalize()
+	return reflect.DeepEqual(a, b)
 }
 
-func StartRadvd(id int) error {
-	pidFile := "/var/run/radvd/radvd." + strconv.Itoa(id) + ".pid"
-	cfgFile := "/etc/radvd.d/" + strconv.Itoa(id) + ".conf"
+// Clone returns a deep copy of the instance.
+func (i *Instance) Clone() *Instance {
+	c := *i
+	c.Prefixes = append([]Prefix(nil), i.Prefixes...)
+	for n := range c.Prefixes {
+		c.Prefixes[n].Extra = append([]string(nil), c.Prefixes[n].Extra...)
+	}
+	c.Rdnss = append([]RDNSS(nil), i.Rdnss...)
+	for n := range c.Rdnss {
+		c.Rdnss[n].Extra = append([]string(nil), c.Rdnss[n].Extra...)
+	}
+	c.Dnssl = append([]DNSSL(nil), i.Dnssl...)
+	for n := range c.Dnssl {
+		c.Dnssl[n].Extra = append([]string(nil), c.Dnssl[n].Extra...)
+	}
+	c.Nat64Prefixes = append([]NAT64Prefix(nil), i.Nat64Prefixes...)
+	for n := range c.Nat64Prefixes {
+		c.Nat64Prefixes[n].Extra = append([]string(nil), c.Nat64Prefixes[n].Extra...)
+	}
+	c.Routes = append([]Route(nil), i.Routes...)
+	for n := range c.Routes {
+		c.Routes[n].Extra = append([]string(nil), c.Routes[n].Extra...)
+	}
+	c.Clients = append([]string(nil), i.Clients...)
+	c.AdvRASrcAddress = append([]string(nil), i.AdvRASrcAddress...)
+	c.Extra = append([]string(nil), i.Extra...)
+	c.LastStderr = append([]string(nil), i.LastStderr...)
+	c.OtherInterfaces = append([]string(nil), i.OtherInterfaces...)
+	return &c
+}
 
-	cmd := exec.Command(
-		"/usr/sbin/radvd",
-		"-C", cfgFile,
-		"-p", pidFile,
-	)
+func (i *Instance) normalize() Instance {
+	n := *i
+	n.PID = 0
+	n.State = ""
+	n.Restarts = 0
+	n.LastExit = ""
+	n.LastStderr = nil
+	if len(n.Prefixes) == 0 {
+		n.Prefixes = nil
+	}
+	if len(n.Rdnss) == 0 {
+		n.Rdnss = nil
+	}
+	if len(n.Dnssl) == 0 {
+		n.Dnssl = nil
+	}
+	if len(n.Routes) == 0 {
+		n.Routes = nil
+	}
+	if len(n.Clients) == 0 {
+		n.Clients = nil
+	}
+	if len(n.Nat64Prefixes) == 0 {
+		n.Nat64Prefixes = nil
+	}
+	if len(n.AdvRASrcAddress) == 0 {
+		n.AdvRASrcAddress = nil
+	}
+	if len(n.Extra) == 0 {
+		n.Extra = nil
+	}
+	if len(n.OtherInterfaces) == 0 {
+		n.OtherInterfaces = nil
+	}
+	// Clone, so that the nested Extra of the instance are not modified
+	n.Prefixes = append([]Prefix(nil), n.Prefixes...)
+	for k := range n.Prefixes {
+		if len(n.Prefixes[k].Extra) == 0 {
+			n.Prefixes[k].Extra = nil
+		}
+	}
+	n.Rdnss = append([]RDNSS(nil), n.Rdnss...)
+	for k := range n.Rdnss {
+		if len(n.Rdnss[k].Extra) == 0 {
+			n.Rdnss[k].Extra = nil
+		}
+	}
+	n.Dnssl = append([]DNSSL(nil), n.Dnssl...)
+	for k := range n.Dnssl {
+		if len(n.Dnssl[k].Extra) == 0 {
+			n.Dnssl[k].Extra = nil
+		}
+	}
+	n.Nat64Prefixes = append([]NAT64Prefix(nil), n.Nat64Prefixes...)
+	for k := range n.Nat64Prefixes {
+		if len(n.Nat64Prefixes[k].Extra) == 0 {
+			n.Nat64Prefixes[k].Extra = nil
+		}
+	}
+	n.Routes = append([]Route(nil), n.Routes...)
+	for k := range n.Routes {
+		if len(n.Routes[k].Extra) == 0 {
+			n.Routes[k].Extra = nil
+		}
+	}
+	return n
+}
 
-	var out, stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	if err := cmd.Start(); err != nil {
-		os.Remove(cfgFile)
-		return fmt.Errorf("failed to start radvd: %w", err)
+// Manager starts, reloads and stops radvd instances.
+// The HTTP server accepts any Manager, e.g. one built on FakeExecutor in tests.
+type Manager interface {
+	// Instances returns the default instance and the instances found in the config directory.
+	Instances() ([]*Instance, error)
+	// Configure writes the config file of the instance.
+	Configure(i *Instance) error
+	// Unconfigure removes the config file of the instance.
+	Unconfigure(id int) error
+	Check(id int) error
+	Start(id int) error
+	// Reload makes the instance re-read its config file. It returns
+	// ErrNotRunning when no radvd process runs for the instance.
+	Reload(id int) error
+	// Stop stops the instance and removes its config, PID and log files.
+	Stop(id int) error
+	// Adopt supervises a radvd process that is already running for the instance.
+	Adopt(id int) (int, error)
+	Status(id int) Status
+	// CleanUp stops all instances and removes every config and PID file.
+	CleanUp() error
+}
+
+// RadvdManager is the Manager built from an Executor, a FileSystem and Paths.
+type RadvdManager struct {
+	Supervisor *Supervisor
+	// Templates are the custom config templates. Nil writes every config with MarshalRadvdConfig.
+	Templates *Templates
+	exec      Executor
+	fs        FileSystem
+	paths     Paths
+
+	versionMu sync.Mutex
+	version   *RadvdVersion
+}
+
+func NewManager(exec Executor, fs FileSystem, paths Paths, logger *slog.Logger) *RadvdManager {
+	return &RadvdManager{
+		Supervisor: NewSupervisor(exec, fs, paths, logger),
+		exec:       exec,
+		fs:         fs,
+		paths:      paths,
 	}
+}
 
-	return nil
+var defaultManager = NewManager(OSExecutor{}, OSFileSystem{}, DefaultPaths(), nil)
+
+// Instances returns the instances of the default config and of the config
+// directory. A config file that can not be read or parsed is logged and
+// skipped, so that it does not hide the others.
+func (m *RadvdManager) Instances() ([]*Instance, error) {
+	instances := []*Instance{}
+	if instance, err := m.readInstance(m.paths.DefaultConf, defaultRadvdInstanceID); err != nil {
+		m.Supervisor.logger().Error("Skipping radvd config", "file", m.paths.DefaultConf, "error", err.Error())
+	} else {
+		instances = append(instances, instance)
+	}
+	files, err := m.fs.Glob(filepath.Join(m.paths.ConfDir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		base := strings.TrimSuffix(filepath.Base(file), ".conf")
+		id, err := strconv.Atoi(base)
+		if err != nil {
+			fmt.Printf("Failed to convert instance number from file name: %v\n", err)
+			continue
+		}
+		instance, err := m.readInstance(file, id)
+		if err != nil {
+			m.Supervisor.logger().Error("Skipping radvd config", "file", file, "error", err.Error())
+			continue
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
 }
 
-func ReloadRadvd(id int) error {
-	pidFile := "/var/run/radvd/radvd." + strconv.Itoa(id) + ".pid"
-	pidStr, err := os.ReadFile(pidFile)
+func (m *RadvdManager) readInstance(file string, id int) (*Instance, error) {
+	data, err := m.fs.ReadFile(file)
 	if err != nil {
-		return fmt.Errorf("failed to read PID file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %v", err)
 	}
-	pid, err := strconv.Atoi(strings.TrimSpace(string(pidStr)))
+	return parseRadvdConf(file, data, id)
+}
+
+// Configure writes the config file of the instance. Without a template, an
+// existing file is edited in place, so that comments and directives added by
+// hand are kept.
+// Options that the installed radvd does not support are rejected with an
+// *UnsupportedError before anything is written.
+func (m *RadvdManager) Configure(i *Instance) error {
+	if needsVersion(i) {
+		version, err := m.Version()
+		if err != nil {
+			return err
+		}
+		if errs := version.Unsupported(i); len(errs) > 0 {
+			return &UnsupportedError{errs}
+		}
+	}
+	file := m.paths.ConfFile(int(i.ID))
+	var conf []byte
+	if m.Templates.Lookup(i) == nil {
+		if src, err := m.fs.ReadFile(file); err == nil {
+			conf, err = UpdateRadvdConf(file, src, i)
+			if err != nil {
+				m.Supervisor.logger().Warn("rewriting config file", "file", file, "error", err)
+				conf = nil
+			}
+		}
+	}
+	if conf == nil {
+		var err error
+		if conf, err = m.Templates.Render(i); err != nil {
+			return err
+		}
+	}
+	if err := m.fs.WriteFile(file, conf, 0644); err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	return nil
+}
+
+// Version returns the version of radvd. It is detected once, on first use.
+func (m *RadvdManager) Version() (RadvdVersion, error) {
+	m.versionMu.Lock()
+	defer m.versionMu.Unlock()
+	if m.version != nil {
+		return *m.version, nil
+	}
+	out, err := m.exec.Output(m.paths.Radvd, "--version")
 	if err != nil {
-		fmt.Println("Error:", err)
-		return fmt.Errorf("failed to convert PID to int: %w", err)
+		return RadvdVersion{}, fmt.Errorf("failed to detect radvd version: %v", err)
 	}
-	process, err := os.FindProcess(pid)
+	version, err := ParseRadvdVersion(out)
 	if err != nil {
-		return fmt.Errorf("failed to find radvd process: %w", err)
+		return RadvdVersion{}, fmt.Errorf("failed to detect radvd version: %v", err)
 	}
-	if err := process.Signal(syscall.SIGHUP); err != nil {
-		return fmt.Errorf("failed to reload radvd: %w", err)
+	m.version = &version
+	return version, nil
+}
+
+func (m *RadvdManager) Unconfigure(id int) error {
+	if err := m.fs.Remove(m.paths.ConfFile(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("faild to remove config file: %w", err)
 	}
+	return nil
+}
 
+func (m *RadvdManager) Check(id int) error {
+	if err := m.exec.Run(m.paths.Radvd, "-C", m.paths.ConfFile(id), "--configtest"); err != nil {
+		return fmt.Errorf("failt to check configure: %w", err)
+	}
 	return nil
 }
 
-func StopRadvd(id int) error {
-	if id == 0 {
-		return nil
+// Start starts and supervises radvd for the instance. If it fails to start,
+// the config file is removed, unless the instance is already supervised and
+// still needs it.
+func (m *RadvdManager) Start(id int) error {
+	_, supervised := m.Supervisor.Status(id)
+	if err := m.Supervisor.Start(id); err != nil {
+		if !supervised {
+			m.fs.Remove(m.paths.ConfFile(id))
+		}
+		return err
 	}
-	pidFile := "/var/run/radvd/radvd." + strconv.Itoa(id) + ".pid"
-	pidStr, err := os.ReadFile(pidFile)
-	if err != nil {
-		return fmt.Errorf("error opening PID file: %w", err)
+	return nil
+}
+
+// Reload makes radvd re-read the config file of the instance. An instance
+// the supervisor gave up on is started again, with the new config.
+func (m *RadvdManager) Reload(id int) error {
+	if status, ok := m.Supervisor.Status(id); ok && status.State == StateFailed {
+		return m.Supervisor.Start(id)
 	}
-	pid, err := strconv.Atoi(strings.TrimSpace(string(pidStr)))
-	if err != nil {
-		fmt.Println("Error:", err)
-		return fmt.Errorf("failed to convert PID to int: %w", err)
+	err := m.Supervisor.Reload(id)
+	if !errors.Is(err, errNotSupervised) {
+		return err
 	}
-	process, err := os.FindProcess(pid)
+	pid, err := m.PID(id)
 	if err != nil {
-		return fmt.Errorf("failed to find radvd process: %w", err)
+		return fmt.Errorf("%w: %v", ErrNotRunning, err)
 	}
-	if err := process.Signal(syscall.SIGTERM); err != nil {
+	if err := m.exec.Signal(pid, syscall.SIGHUP); errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("%w: process %d does not exist", ErrNotRunning, pid)
+	} else if err != nil {
 		return fmt.Errorf("failed to reload radvd: %w", err)
 	}
-	if err := os.Remove(pidFile); err != nil {
+	return nil
+}
+
+func (m *RadvdManager) Stop(id int) error {
+	if id == 0 {
+		return nil
+	}
+	err := m.Supervisor.Stop(id)
+	if errors.Is(err, errNotSupervised) {
+		// not started by us, stop it through the PID file if it is running
+		if pid, err := m.PID(id); err == nil {
+			if err := m.exec.Signal(pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+				return fmt.Errorf("failed to stop radvd: %w", err)
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := m.fs.Remove(m.paths.PIDFile(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("faild to remove PID file: %w", err)
 	}
-	if err := os.Remove("/etc/radvd.d/" + strconv.Itoa(id) + ".conf"); err != nil {
-		return fmt.Errorf("faild to remove config file: %w", err)
+	if err := m.fs.Remove(m.paths.LogFile(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("faild to remove log file: %w", err)
 	}
-
-	return nil
+	return m.Unconfigure(id)
 }
 
-func GetRadvdPID(id int) (int, error) {
-	pidFile := "/var/run/radvd/radvd." + strconv.Itoa(id) + ".pid"
-	pidStr, err := os.ReadFile(pidFile)
+// PID returns the PID written by radvd to its PID file.
+func (m *RadvdManager) PID(id int) (int, error) {
+	pidStr, err := m.fs.ReadFile(m.paths.PIDFile(id))
 	if err != nil {
 		return 0, fmt.Errorf("failed to read PID file: %w", err)
 	}
 	pid, err := strconv.Atoi(strings.TrimSpace(string(pidStr)))
 	if err != nil {
-		fmt.Println("Error:", err)
 		return 0, fmt.Errorf("failed to convert PID to int: %w", err)
 	}
-
 	return pid, nil
 }
+
+// Adopt looks up the radvd process of the instance through its PID file and
+// supervises it. The process is checked against its command line, so that a
+// stale PID file reused by another process is not adopted.
+func (m *RadvdManager) Adopt(id int) (int, error) {
+	pid, err := m.PID(id)
+	if err != nil {
+		return 0, err
+	}
+	args, err := m.exec.Cmdline(pid)
+	if err != nil || len(args) == 0 {
+		return 0, fmt.Errorf("radvd process is not running: %v", err)
+	}
+	if filepath.Base(args[0]) != filepath.Base(m.paths.Radvd) {
+		return 0, fmt.Errorf("process %d is not radvd: %s", pid, args[0])
+	}
+	for _, a := range args[1:] {
+		if a == m.paths.ConfFile(id) {
+			m.Supervisor.Adopt(id, pid)
+			return pid, nil
+		}
+	}
+	return 0, fmt.Errorf("process %d does not use %s", pid, m.paths.ConfFile(id))
+}
+
+// Status returns the runtime status of the instance. Instances that are
+// not supervised only report the PID found in their PID file.
+func (m *RadvdManager) Status(id int) Status {
+	if status, ok := m.Supervisor.Status(id); ok {
+		return status
+	}
+	pid, _ := m.PID(id)
+	return Status{PID: pid}
+}
+
+func (m *RadvdManager) CleanUp() error {
+	for _, id := range m.Supervisor.IDs() {
+		m.Stop(id)
+	}
+	var errs []error
+	files, err := m.fs.Glob(filepath.Join(m.paths.ConfDir, "*"))
+	errs = append(errs, err)
+	pidFiles, err := m.fs.Glob(filepath.Join(m.paths.PIDDir, "radvd.*"))
+	errs = append(errs, err)
+	for _, file := range append(files, pidFiles...) {
+		if err := m.fs.Remove(file); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", file, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func CheckRadvdConfig(id int) error {
+	return defaultManager.Check(id)
+}
+
+func StartRadvd(id int) error {
+	return defaultManager.Start(id)
+}
+
+func ReloadRadvd(id int) error {
+	return defaultManager.Reload(id)
+}
+
+func StopRadvd(id int) error {
+	return defaultManager.Stop(id)
+}
+
+func GetRadvdPID(id int) (int, error) {
+	return defaultManager.PID(id)
+}
+
+func AdoptRadvd(id int) (int, error) {
+	return defaultManager.Adopt(id)
+}
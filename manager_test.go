@@ -0,0 +1,138 @@
+package radvd_manager
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestManager returns a fake manager that does not log.
+func newTestManager() (*RadvdManager, *FakeExecutor, *MemFS) {
+	m, exec, fs := NewFakeManager()
+	m.Supervisor.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return m, exec, fs
+}
+
+// waitState waits until the supervisor reports the state for the instance.
+func waitState(t *testing.T, m *RadvdManager, id int, state string) Status {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, _ := m.Supervisor.Status(id)
+		if status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("instance %d is %q, want %q", id, status.State, state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagerReloadWhileRestarting(t *testing.T) {
+	m, exec, fs := newTestManager()
+	m.Supervisor.MinBackoff = 50 * time.Millisecond
+	i := &Instance{ID: 1, Name: "eth1", AdvSendAdvert: true}
+	if err := m.Configure(i); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	pid := m.Status(1).PID
+	exec.Crash(pid)
+	waitState(t, m, 1, StateRestarting)
+
+	// a new config is picked up by the respawned radvd, not rejected
+	i.AdvDefaultLifetime = 600
+	if err := m.Configure(i); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(1); err != nil {
+		t.Fatalf("Reload of a restarting instance: %v", err)
+	}
+	// Start of a supervised instance fails, but keeps its config file
+	if err := m.Start(1); err == nil {
+		t.Fatal("Start of a restarting instance succeeded")
+	}
+	if _, err := fs.ReadFile(m.paths.ConfFile(1)); err != nil {
+		t.Fatalf("config file of the supervised instance was removed: %v", err)
+	}
+	status := waitState(t, m, 1, StateRunning)
+	if status.PID == pid {
+		t.Fatal("radvd was not respawned")
+	}
+}
+
+func TestManagerReloadNotRunning(t *testing.T) {
+	m, _, _ := newTestManager()
+	if err := m.Reload(1); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("Reload = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestManagerReloadFailed(t *testing.T) {
+	m, exec, _ := newTestManager()
+	m.Supervisor.MinBackoff = time.Millisecond
+	m.Supervisor.MaxRestarts = 0
+	if err := m.Configure(&Instance{ID: 1, Name: "eth1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	exec.Crash(m.Status(1).PID)
+	waitState(t, m, 1, StateFailed)
+	if err := m.Reload(1); err != nil {
+		t.Fatalf("Reload of a failed instance: %v", err)
+	}
+	waitState(t, m, 1, StateRunning)
+}
+
+func TestManagerAdoptAfterExit(t *testing.T) {
+	m, exec, fs := newTestManager()
+	if err := m.Configure(&Instance{ID: 1, Name: "eth1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	pid := m.Status(1).PID
+	args, _ := exec.Cmdline(pid)
+	if !slices.Contains(args, m.paths.LogFile(1)) {
+		t.Fatalf("radvd does not log to %s: %v", m.paths.LogFile(1), args)
+	}
+
+	// the manager exits and leaves radvd running, a new one adopts it
+	next := NewManager(exec, fs, m.paths, m.Supervisor.Logger)
+	got, err := next.Adopt(1)
+	if err != nil {
+		t.Fatalf("Adopt: %v", err)
+	}
+	if got != pid {
+		t.Fatalf("adopted PID %d, want %d", got, pid)
+	}
+	status := next.Status(1)
+	if status.State != StateRunning || status.PID != pid {
+		t.Fatalf("status = %+v", status)
+	}
+	if len(status.LastStderr) != 1 || !strings.Contains(status.LastStderr[0], "started") {
+		t.Fatalf("log of the adopted radvd = %q", status.LastStderr)
+	}
+	if err := next.Reload(1); err != nil {
+		t.Fatal(err)
+	}
+	if exec.Reloads(pid) != 1 {
+		t.Fatal("adopted radvd was not reloaded")
+	}
+	if err := next.Stop(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.ReadFile(m.paths.LogFile(1)); err == nil {
+		t.Fatal("log file was not removed")
+	}
+}
@@ -1,11 +1,8 @@
 package radvd_manager
 
 import (
-	"bufio"
 	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -14,153 +11,378 @@ const (
 	defaultRadvdInstanceID = 0
 )
 
-func parseRadvdConf(filePath string, id int) (*Instance, error) {
-	var instance Instance
-	var prefix Prefix
-	var rdnss RDNSS
-	var route Route
-
-	file, err := os.Open(filePath)
+// parseRadvdConf reads the instance from the interface block of the config
+// file. A config file of the manager has a single interface block, so more
+// blocks are rejected at the second one instead of being dropped on the next
+// write. The default config (/etc/radvd.conf) is never written and may have
+// more: its first block is the instance, the others are kept verbatim in
+// OtherInterfaces.
+func parseRadvdConf(name string, data []byte, id int) (*Instance, error) {
+	conf, err := ParseRadvdConf(name, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %v", err)
-	}
-	defer file.Close()
-	instance.ID = uint32(id)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		switch {
-		case strings.HasPrefix(line, "interface"):
-			fields := strings.Fields(line)
-			instance.Name = fields[1]
-
-		case strings.HasPrefix(line, "AdvSendAdvert"):
-			instance.AdvSendAdvert = parseBool(strings.TrimSuffix(line[len("AdvSendAdvert "):], ";"))
-
-		case strings.HasPrefix(line, "MinRtrAdvInterval"):
-			instance.MinRtrAdvInterval = parseUint32(strings.TrimSuffix(line[len("MinRtrAdvInterval "):], ";"))
-
-		case strings.HasPrefix(line, "MaxRtrAdvInterval"):
-			instance.MaxRtrAdvInterval = parseUint32(strings.TrimSuffix(line[len("MaxRtrAdvInterval "):], ";"))
-
-		case strings.HasPrefix(line, "AdvManagedFlag"):
-			instance.AdvManagedFlag = parseBool(strings.TrimSuffix(line[len("AdvManagedFlag "):], ";"))
-
-		case strings.HasPrefix(line, "AdvOtherConfigFlag"):
-			instance.AdvOtherConfigFlag = parseBool(strings.TrimSuffix(line[len("AdvOtherConfigFlag "):], ";"))
-
-		case strings.HasPrefix(line, "AdvDefaultLifetime"):
-			instance.AdvDefaultLifetime = parseUint32(strings.TrimSuffix(line[len("AdvDefaultLifetime "):], ";"))
-
-		case strings.HasPrefix(line, "AdvDefaultPreference"):
-			instance.AdvDefaultPreference = strings.TrimSuffix(line[len("AdvDefaultPreference "):], ";")
+		return nil, err
+	}
+	if len(conf.Interfaces) == 0 {
+		return nil, fmt.Errorf("%s: no interface block", name)
+	}
+	if len(conf.Interfaces) > 1 && id != defaultRadvdInstanceID {
+		first, second := conf.Interfaces[0], conf.Interfaces[1]
+		return nil, &ConfError{second.Pos, fmt.Sprintf("interface %s: only one interface block is supported per file, %s is at line %d", second.Args[0], first.Args[0], first.Pos.Line)}
+	}
+	instance, err := InstanceFromInterface(conf.Interfaces[0], id)
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range conf.Interfaces[1:] {
+		instance.OtherInterfaces = append(instance.OtherInterfaces, string(data[iface.span.comment:iface.span.end]))
+	}
+	return instance, nil
+}
 
-		case strings.HasPrefix(line, "prefix"):
-			fields := strings.Fields(line)
-			prefix = Prefix{Prefix: fields[1]}
+// InstanceFromInterface converts an interface block into an instance.
+// Directives that are not modelled by Instance are kept in Extra.
+func InstanceFromInterface(iface *Directive, id int) (*Instance, error) {
+	if iface.Name != "interface" || len(iface.Args) != 1 {
+		return nil, &ConfError{iface.Pos, "expected \"interface <name> { ... };\""}
+	}
+	instance := Instance{ID: uint32(id), Name: iface.Args[0]}
+	// the config writer records the router ID in a comment
+	for _, c := range iface.Comments {
+		if routerID, ok := strings.CutPrefix(strings.TrimSpace(strings.TrimPrefix(c, "#")), "RouterID:"); ok {
+			instance.RouterID = strings.TrimSpace(routerID)
+		}
+	}
+	var err error
+	for _, d := range iface.Block {
+		switch d.Name {
+		case "AdvSendAdvert":
+			instance.AdvSendAdvert, err = boolArg(d)
+		case "MinRtrAdvInterval":
+			instance.MinRtrAdvInterval, err = uint32Arg(d)
+		case "MaxRtrAdvInterval":
+			instance.MaxRtrAdvInterval, err = uint32Arg(d)
+		case "AdvManagedFlag":
+			instance.AdvManagedFlag, err = boolArg(d)
+		case "AdvOtherConfigFlag":
+			instance.AdvOtherConfigFlag, err = boolArg(d)
+		case "AdvDefaultLifetime":
+			instance.AdvDefaultLifetime, err = uint32Arg(d)
+		case "AdvDefaultPreference":
+			instance.AdvDefaultPreference, err = preferenceArg(d)
+		case "AdvLinkMTU":
+			instance.AdvLinkMTU, err = ptr(uint32Arg(d))
+		case "AdvCurHopLimit":
+			instance.AdvCurHopLimit, err = ptr(uint32Arg(d))
+		case "AdvReachableTime":
+			instance.AdvReachableTime, err = ptr(uint32Arg(d))
+		case "AdvRetransTimer":
+			instance.AdvRetransTimer, err = ptr(uint32Arg(d))
+		case "AdvSourceLLAddress":
+			instance.AdvSourceLLAddress, err = ptr(boolArg(d))
+		case "UnicastOnly":
+			instance.UnicastOnly, err = ptr(boolArg(d))
+		case "AdvRASolicitedUnicast":
+			instance.AdvRASolicitedUnicast, err = ptr(boolArg(d))
+		case "IgnoreIfMissing":
+			instance.IgnoreIfMissing, err = ptr(boolArg(d))
+		case "MinDelayBetweenRAs":
+			instance.MinDelayBetweenRAs, err = ptr(decimalArg(d))
+		case "AdvHomeAgentFlag":
+			instance.AdvHomeAgentFlag, err = ptr(boolArg(d))
+		case "AdvHomeAgentInfo":
+			instance.AdvHomeAgentInfo, err = ptr(boolArg(d))
+		case "HomeAgentLifetime":
+			instance.HomeAgentLifetime, err = ptr(uint32Arg(d))
+		case "HomeAgentPreference":
+			instance.HomeAgentPreference, err = ptr(uint32Arg(d))
+		case "AdvMobRtrSupportFlag":
+			instance.AdvMobRtrSupportFlag, err = ptr(boolArg(d))
+		case "AdvIntervalOpt":
+			instance.AdvIntervalOpt, err = ptr(boolArg(d))
+		case "AdvCaptivePortalAPI":
+			instance.AdvCaptivePortalAPI, err = stringArg(d)
+		case "nat64prefix":
+			err = parseNAT64Prefix(&instance, d)
+		case "AdvRASrcAddress":
+			var addresses []string
+			addresses, err = addressesArg(d)
+			instance.AdvRASrcAddress = append(instance.AdvRASrcAddress, addresses...)
+		case "prefix":
+			err = parsePrefix(&instance, d)
+		case "RDNSS":
+			err = parseRDNSS(&instance, d)
+		case "DNSSL":
+			err = parseDNSSL(&instance, d)
+		case "route":
+			err = parseRoute(&instance, d)
+		case "clients":
+			err = parseClients(&instance, d)
+		default:
+			instance.Extra = append(instance.Extra, d.String())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		case strings.HasPrefix(line, "AdvOnLink"):
-			prefix.AdvOnLink = parseBool(strings.TrimSuffix(line[len("AdvOnLink "):], ";"))
+	return &instance, nil
+}
 
-		case strings.HasPrefix(line, "AdvAutonomous"):
-			prefix.AdvAutonomous = parseBool(strings.TrimSuffix(line[len("AdvAutonomous "):], ";"))
+func parsePrefix(instance *Instance, d *Directive) error {
+	if !d.IsBlock || len(d.Args) != 1 {
+		// e.g. "prefix ::/64;" is kept as it is
+		instance.Extra = append(instance.Extra, d.String())
+		return nil
+	}
+	prefix := Prefix{Prefix: d.Args[0]}
+	var err error
+	for _, o := range d.Block {
+		switch o.Name {
+		case "AdvOnLink":
+			prefix.AdvOnLink, err = boolArg(o)
+		case "AdvAutonomous":
+			prefix.AdvAutonomous, err = boolArg(o)
+		case "AdvRouterAddr":
+			prefix.AdvRouterAddr, err = boolArg(o)
+		case "AdvValidLifetime":
+			prefix.AdvValidLifetime, err = lifetimeArg(o)
+		case "AdvPreferredLifetime":
+			prefix.AdvPreferredLifetime, err = ptr(lifetimeArg(o))
+		case "DeprecatePrefix":
+			prefix.DeprecatePrefix, err = ptr(boolArg(o))
+		case "DecrementLifetimes":
+			prefix.DecrementLifetimes, err = ptr(boolArg(o))
+		default:
+			prefix.Extra = append(prefix.Extra, o.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	instance.Prefixes = append(instance.Prefixes, prefix)
+	return nil
+}
 
-		case strings.HasPrefix(line, "AdvRouterAddr"):
-			prefix.AdvRouterAddr = parseBool(strings.TrimSuffix(line[len("AdvRouterAddr "):], ";"))
+// parseRDNSS adds an RDNSS entry per address, "RDNSS a b { ... };" has the options for both.
+func parseRDNSS(instance *Instance, d *Directive) error {
+	if !d.IsBlock || len(d.Args) == 0 {
+		instance.Extra = append(instance.Extra, d.String())
+		return nil
+	}
+	var options RDNSS
+	var err error
+	for _, o := range d.Block {
+		switch o.Name {
+		case "AdvRDNSSLifetime":
+			options.AdvRdnssLifetime, err = lifetimeArg(o)
+		case "FlushRDNSS":
+			options.FlushRDNSS, err = ptr(boolArg(o))
+		default:
+			options.Extra = append(options.Extra, o.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, address := range d.Args {
+		rdnss := options
+		rdnss.Address = address
+		rdnss.Extra = append([]string(nil), options.Extra...)
+		instance.Rdnss = append(instance.Rdnss, rdnss)
+	}
+	return nil
+}
 
-		case strings.HasPrefix(line, "AdvValidLifetime"):
-			prefix.AdvValidLifetime = parseUint32(strings.TrimSuffix(line[len("AdvValidLifetime "):], ";"))
+// parseDNSSL adds a DNSSL entry per domain, like parseRDNSS.
+func parseDNSSL(instance *Instance, d *Directive) error {
+	if !d.IsBlock || len(d.Args) == 0 {
+		instance.Extra = append(instance.Extra, d.String())
+		return nil
+	}
+	var options DNSSL
+	var err error
+	for _, o := range d.Block {
+		switch o.Name {
+		case "AdvDNSSLLifetime":
+			options.AdvDnsslLifetime, err = lifetimeArg(o)
+		case "FlushDNSSL":
+			options.FlushDNSSL, err = ptr(boolArg(o))
+		default:
+			options.Extra = append(options.Extra, o.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, domain := range d.Args {
+		dnssl := options
+		dnssl.Domain = domain
+		dnssl.Extra = append([]string(nil), options.Extra...)
+		instance.Dnssl = append(instance.Dnssl, dnssl)
+	}
+	return nil
+}
 
-		case line == "};":
-			if prefix.Prefix != "" {
-				instance.Prefixes = append(instance.Prefixes, prefix)
-				prefix = Prefix{}
-			}
-			if rdnss.Address != "" {
-				instance.Rdnss = append(instance.Rdnss, rdnss)
-				rdnss = RDNSS{}
-			}
-			if route.Route != "" {
-				instance.Routes = append(instance.Routes, route)
-				route = Route{}
-			}
+func parseNAT64Prefix(instance *Instance, d *Directive) error {
+	if !d.IsBlock || len(d.Args) != 1 {
+		instance.Extra = append(instance.Extra, d.String())
+		return nil
+	}
+	prefix := NAT64Prefix{Prefix: d.Args[0]}
+	var err error
+	for _, o := range d.Block {
+		switch o.Name {
+		case "AdvValidLifetime":
+			prefix.AdvValidLifetime, err = ptr(uint32Arg(o))
+		default:
+			prefix.Extra = append(prefix.Extra, o.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	instance.Nat64Prefixes = append(instance.Nat64Prefixes, prefix)
+	return nil
+}
 
-		case strings.HasPrefix(line, "RDNSS"):
-			fields := strings.Fields(line)
-			rdnss = RDNSS{Address: fields[1]}
+func parseRoute(instance *Instance, d *Directive) error {
+	if !d.IsBlock || len(d.Args) != 1 {
+		instance.Extra = append(instance.Extra, d.String())
+		return nil
+	}
+	route := Route{Route: d.Args[0]}
+	var err error
+	for _, o := range d.Block {
+		switch o.Name {
+		case "AdvRouteLifetime":
+			route.AdvRouteLifetime, err = lifetimeArg(o)
+		case "AdvRoutePreference":
+			route.AdvRoutePreference, err = preferenceArg(o)
+		case "RemoveRoute":
+			route.RemoveRoute, err = ptr(boolArg(o))
+		default:
+			route.Extra = append(route.Extra, o.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	instance.Routes = append(instance.Routes, route)
+	return nil
+}
 
-		case strings.HasPrefix(line, "AdvRDNSSLifetime"):
-			rdnss.AdvRdnssLifetime = parseUint32(strings.TrimSuffix(line[len("AdvRDNSSLifetime "):], ";"))
+func parseClients(instance *Instance, d *Directive) error {
+	clients, err := addressesArg(d)
+	instance.Clients = append(instance.Clients, clients...)
+	return err
+}
 
-		case strings.HasPrefix(line, "route"):
-			fields := strings.Fields(line)
-			route = Route{Route: fields[1]}
+// addressesArg reads a block of addresses, e.g. "clients { fe80::1; fe80::2; };".
+func addressesArg(d *Directive) ([]string, error) {
+	if !d.IsBlock || len(d.Args) != 0 {
+		return nil, &ConfError{d.Pos, fmt.Sprintf("expected \"%s { <address>; ... };\"", d.Name)}
+	}
+	var addresses []string
+	for _, a := range d.Block {
+		if a.IsBlock || len(a.Args) != 0 {
+			return nil, &ConfError{a.Pos, fmt.Sprintf("expected an address, found %q", a.String())}
+		}
+		addresses = append(addresses, a.Name)
+	}
+	return addresses, nil
+}
 
-		case strings.HasPrefix(line, "AdvRouteLifetime"):
-			route.AdvRouteLifetime = parseUint32(strings.TrimSuffix(line[len("AdvRouteLifetime "):], ";"))
+func InitInstances(instances *[]*Instance) error {
+	found, err := defaultManager.Instances()
+	if err != nil {
+		return err
+	}
+	*instances = append(*instances, found...)
 
-		case strings.HasPrefix(line, "AdvRoutePreference"):
-			route.AdvRoutePreference = strings.TrimSuffix(line[len("AdvRoutePreference "):], ";")
+	return nil
+}
 
-		case strings.HasPrefix(line, "clients"):
-			for scanner.Scan() {
-				clientLine := strings.TrimSpace(scanner.Text())
-				if clientLine == "};" {
-					break
-				}
-				instance.Clients = append(instance.Clients, strings.TrimSuffix(clientLine, ";"))
-			}
-		}
+func singleArg(d *Directive) (string, error) {
+	if d.IsBlock || len(d.Args) != 1 {
+		return "", &ConfError{d.Pos, fmt.Sprintf("%s takes a single value", d.Name)}
 	}
+	return d.Args[0], nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to scan file: %v", err)
+// stringArg is a quoted string, e.g. "https://example.com/api".
+func stringArg(d *Directive) (string, error) {
+	value, err := singleArg(d)
+	if err != nil {
+		return "", err
+	}
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return "", &ConfError{d.Pos, fmt.Sprintf("%s must be a quoted string, not %s", d.Name, value)}
 	}
+	return value[1 : len(value)-1], nil
+}
 
-	return &instance, nil
+func boolArg(d *Directive) (bool, error) {
+	value, err := singleArg(d)
+	if err != nil {
+		return false, err
+	}
+	switch value {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, &ConfError{d.Pos, fmt.Sprintf("%s must be on or off, not %q", d.Name, value)}
 }
 
-func InitInstances(instances *[]*Instance) error {
-	defaultInstance, err := parseRadvdConf(defaultRadvdCondFile, defaultRadvdInstanceID)
+func uint32Arg(d *Directive) (uint32, error) {
+	value, err := singleArg(d)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	*instances = append(*instances, defaultInstance)
-	err = filepath.WalkDir(RadvdConfPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".conf") {
-			base := strings.TrimSuffix(d.Name(), ".conf")
-			id, err := strconv.Atoi(base)
-			if err != nil {
-				fmt.Printf("Failed to convert instance number from file name: %v\n", err)
-				return nil
-			}
-			instance, err := parseRadvdConf(path, id)
-			if err != nil {
-				return err
-			}
-			*instances = append(*instances, instance)
-		}
-		return nil
-	})
+	num, err := strconv.ParseUint(value, 10, 32)
 	if err != nil {
-		return err
+		return 0, &ConfError{d.Pos, fmt.Sprintf("%s must be a number, not %q", d.Name, value)}
 	}
+	return uint32(num), nil
+}
 
-	return nil
+// lifetimeArg is a number of seconds or "infinity".
+func lifetimeArg(d *Directive) (uint32, error) {
+	if len(d.Args) == 1 && d.Args[0] == "infinity" {
+		return math.MaxUint32, nil
+	}
+	return uint32Arg(d)
+}
+
+// decimalArg is a number of seconds that may have a fraction, e.g. "0.05".
+func decimalArg(d *Directive) (float64, error) {
+	value, err := singleArg(d)
+	if err != nil {
+		return 0, err
+	}
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(num) || math.IsInf(num, 0) || num < 0 {
+		return 0, &ConfError{d.Pos, fmt.Sprintf("%s must be a number, not %q", d.Name, value)}
+	}
+	return num, nil
 }
 
-func parseBool(value string) bool {
-	return value == "yes" || value == "on" || value == "true"
+// ptr returns the value of an option that is optional in Instance.
+func ptr[T any](value T, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
 }
 
-func parseUint32(value string) uint32 {
-	num, _ := strconv.ParseUint(value, 10, 32)
-	return uint32(num)
+func preferenceArg(d *Directive) (string, error) {
+	value, err := singleArg(d)
+	if err != nil {
+		return "", err
+	}
+	if value == "" || !isPreference(value) {
+		return "", &ConfError{d.Pos, fmt.Sprintf("%s must be low, medium or high, not %q", d.Name, value)}
+	}
+	return value, nil
 }
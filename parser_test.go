@@ -0,0 +1,65 @@
+package radvd_manager
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInstancesMultipleInterfaces(t *testing.T) {
+	m, _, fs := newTestManager()
+	second := "# lab network\ninterface eth1 {\n    AdvSendAdvert on;\n    prefix 2001:db8:1::/64 {\n    };\n};"
+	fs.WriteFile(m.paths.DefaultConf, []byte("interface eth0 {\n    AdvSendAdvert on;\n};\n\n"+second+"\n"), 0644)
+	if err := m.Configure(&Instance{ID: 1, Name: "eth2", AdvSendAdvert: true}); err != nil {
+		t.Fatal(err)
+	}
+	// config files of the manager must have a single block, broken ones are skipped
+	fs.WriteFile(m.paths.ConfFile(2), []byte("interface eth3 {\n};\ninterface eth4 {\n};\n"), 0644)
+	fs.WriteFile(m.paths.ConfFile(3), []byte("interface eth5 {\n"), 0644)
+
+	instances, err := m.Instances()
+	if err != nil {
+		t.Fatalf("Instances: %v", err)
+	}
+	if len(instances) != 2 || instances[0].ID != 0 || instances[1].ID != 1 {
+		t.Fatalf("Instances = %+v, want instances 0 and 1", instances)
+	}
+	if i := instances[0]; i.Name != "eth0" || len(i.OtherInterfaces) != 1 || i.OtherInterfaces[0] != second {
+		t.Fatalf("default instance %s, other interfaces %q", i.Name, i.OtherInterfaces)
+	}
+}
+
+func TestParseMultipleInterfaces(t *testing.T) {
+	conf := []byte("interface eth0 {\n};\n\ninterface eth1 {\n};\n")
+	_, err := parseRadvdConf("1.conf", conf, 1)
+	var cerr *ConfError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("parse = %v, want a *ConfError", err)
+	}
+	if cerr.Pos.Line != 4 || cerr.Pos.Col != 1 {
+		t.Fatalf("error at %s, want the second interface block", cerr.Pos)
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	for _, c := range []struct {
+		conf string
+		want string
+	}{
+		{"interface eth1 {\n    AdvSendAdvert on\n};\n", "test.conf:3:1"},
+		{"interface eth1 {\n    AdvSendAdvert on;\n", "test.conf:3:1"},
+		{"interface eth1 {\n    AdvSendAdvert maybe;\n};\n", "test.conf:2:5"},
+		{"interface eth1 {\n    prefix 2001:db8::/64 {\n        AdvValidLifetime x;\n    };\n};\n", "test.conf:3:9"},
+		{"interface eth1 {\n    DNSSL \"a.example.com;\n};\n", "test.conf:2:11"},
+		{"interface eth1 {\n};\n}\n", "test.conf:3:1"},
+	} {
+		_, err := parseRadvdConf("test.conf", []byte(c.conf), 1)
+		var cerr *ConfError
+		if !errors.As(err, &cerr) {
+			t.Errorf("parse of %q = %v, want a *ConfError", c.conf, err)
+			continue
+		}
+		if cerr.Pos.String() != c.want {
+			t.Errorf("parse of %q: error %q, want at %s", c.conf, err, c.want)
+		}
+	}
+}
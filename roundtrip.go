@@ -0,0 +1,494 @@
+package radvd_manager
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FormatRadvdConf formats radvd.conf canonically: one statement per line,
+// indented by four spaces, with comments, ordering and unknown directives kept.
+func FormatRadvdConf(conf *RadvdConf) []byte {
+	var w confWriter
+	for n, iface := range conf.Interfaces {
+		if n > 0 {
+			w.buf.WriteByte('\n')
+		}
+		formatDirective(&w, iface)
+	}
+	for _, c := range conf.Trailing {
+		w.line("%s", c)
+	}
+	return w.buf.Bytes()
+}
+
+func formatDirective(w *confWriter, d *Directive) {
+	for _, c := range d.Comments {
+		w.line("%s", c)
+	}
+	header := strings.Join(append([]string{d.Name}, d.Args...), " ")
+	inline := ""
+	if d.Inline != "" {
+		inline = " " + d.Inline
+	}
+	if !d.IsBlock {
+		w.line("%s;%s", header, inline)
+		return
+	}
+	w.open("%s", header)
+	for _, c := range d.Block {
+		formatDirective(w, c)
+	}
+	for _, c := range d.Trailing {
+		w.line("%s", c)
+	}
+	w.indent--
+	w.line("};%s", inline)
+}
+
+// UpdateRadvdConf edits the first interface block of radvd.conf so that it
+// configures the instance. Only the directives whose values differ are
+// changed, in place; comments, ordering, formatting and directives that
+// Instance does not model are kept. New directives are appended to their block.
+func UpdateRadvdConf(name string, src []byte, i *Instance) ([]byte, error) {
+	if err := checkTokens(i); err != nil {
+		return nil, err
+	}
+	conf, err := ParseRadvdConf(name, src)
+	if err != nil {
+		return nil, err
+	}
+	if len(conf.Interfaces) == 0 {
+		return nil, fmt.Errorf("%s: no interface block", name)
+	}
+	iface := conf.Interfaces[0]
+	old, err := InstanceFromInterface(iface, int(i.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &confEditor{src: src}
+	if old.Name != i.Name {
+		e.replace(iface.span.args[0][0], iface.span.args[0][1], i.Name)
+	}
+	if old.RouterID != i.RouterID {
+		e.updateRouterID(iface, i.RouterID)
+	}
+	e.updateOptions(iface, interfaceOptions(old), interfaceOptions(i))
+	e.updateExtra(iface, old.Extra, i.Extra)
+	e.updateBlocks(iface, "prefix", prefixEntries(old.Prefixes), prefixEntries(i.Prefixes))
+	e.updateMulti(iface, "RDNSS", rdnssEntries(old.Rdnss), rdnssEntries(i.Rdnss))
+	e.updateMulti(iface, "DNSSL", dnsslEntries(old.Dnssl), dnsslEntries(i.Dnssl))
+	e.updateBlocks(iface, "nat64prefix", nat64PrefixEntries(old.Nat64Prefixes), nat64PrefixEntries(i.Nat64Prefixes))
+	e.updateBlocks(iface, "route", routeEntries(old.Routes), routeEntries(i.Routes))
+	e.updateAddresses(iface, "clients", old.Clients, i.Clients)
+	e.updateAddresses(iface, "AdvRASrcAddress", old.AdvRASrcAddress, i.AdvRASrcAddress)
+	return e.apply(), nil
+}
+
+// confEditor collects edits of the source and applies them at once,
+// so that the offsets of the parsed directives stay valid.
+type confEditor struct {
+	src   []byte
+	edits []edit
+}
+
+type edit struct {
+	start, end int
+	text       string
+}
+
+func (e *confEditor) replace(start, end int, text string) {
+	e.edits = append(e.edits, edit{start, end, text})
+}
+
+func (e *confEditor) apply() []byte {
+	edits := make([]edit, len(e.edits))
+	copy(edits, e.edits)
+	// from the end, so that offsets are not shifted; insertions at the
+	// same offset keep the order in which they were added
+	order := make([]int, len(edits))
+	for n := range order {
+		order[n] = n
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if edits[order[a]].start != edits[order[b]].start {
+			return edits[order[a]].start > edits[order[b]].start
+		}
+		return order[a] > order[b]
+	})
+	out := append([]byte(nil), e.src...)
+	for _, n := range order {
+		ed := edits[n]
+		out = append(out[:ed.start], append([]byte(ed.text), out[ed.end:]...)...)
+	}
+	return out
+}
+
+// lineStart returns the offset of the start of the line of off.
+func (e *confEditor) lineStart(off int) int {
+	return bytes.LastIndexByte(e.src[:off], '\n') + 1
+}
+
+// lineEnd returns the offset after the newline of the line of off.
+func (e *confEditor) lineEnd(off int) int {
+	if n := bytes.IndexByte(e.src[off:], '\n'); n >= 0 {
+		return off + n + 1
+	}
+	return len(e.src)
+}
+
+func isBlank(b []byte) bool {
+	return len(bytes.TrimSpace(b)) == 0
+}
+
+// delete removes the directive with its comments, and its lines if nothing else is on them.
+func (e *confEditor) delete(d *Directive) {
+	start, end := d.span.comment, d.span.end
+	if d.Inline != "" {
+		end = e.lineEnd(end)
+		if end > 0 && e.src[end-1] == '\n' {
+			end--
+		}
+	}
+	ls, le := e.lineStart(start), e.lineEnd(end)
+	if isBlank(e.src[ls:start]) && isBlank(e.src[end:le]) {
+		start, end = ls, le
+	} else {
+		for end < len(e.src) && (e.src[end] == ' ' || e.src[end] == '\t') {
+			end++
+		}
+	}
+	e.replace(start, end, "")
+}
+
+// insert appends statements, written at indentation level 0, to the block.
+func (e *confEditor) insert(block *Directive, w *confWriter) {
+	e.insertAt(block, nil, w)
+}
+
+// insertAt inserts statements after the directive after, or at the end of
+// the block if after is nil. The indentation of the file is kept.
+func (e *confEditor) insertAt(block, after *Directive, w *confWriter) {
+	lines := strings.Split(strings.TrimRight(w.buf.String(), "\n"), "\n")
+	close := block.span.close
+	ls := e.lineStart(close)
+	if !isBlank(e.src[ls:close]) {
+		// "{ ... }" on a single line
+		for n, l := range lines {
+			lines[n] = strings.TrimSpace(l)
+		}
+		e.replace(close, close, strings.Join(lines, " ")+" ")
+		return
+	}
+	outer := string(e.src[ls:close])
+	indent := outer + "    "
+	if n := len(block.Block); n > 0 {
+		last := block.Block[n-1]
+		if cls := e.lineStart(last.span.start); isBlank(e.src[cls:last.span.start]) {
+			indent = string(e.src[cls:last.span.start])
+		}
+	}
+	unit, ok := strings.CutPrefix(indent, outer)
+	if !ok || unit == "" {
+		unit = "    "
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		depth := 0
+		for strings.HasPrefix(l, "    ") {
+			l = l[4:]
+			depth++
+		}
+		b.WriteString(indent + strings.Repeat(unit, depth) + l + "\n")
+	}
+	at := ls
+	if after != nil {
+		at = e.lineEnd(after.span.end)
+	}
+	e.replace(at, at, b.String())
+}
+
+// insertOption adds an option after the last option of the block.
+func (e *confEditor) insertOption(block *Directive, o option) {
+	var w confWriter
+	w.line("%s %s;", o.name, o.value)
+	var after *Directive
+	for _, d := range block.Block {
+		if !d.IsBlock {
+			after = d
+		}
+	}
+	// only if it ends its line, and not on a single-line block
+	if after != nil && (!isBlank(e.src[e.lineStart(after.span.start):after.span.start]) ||
+		(after.Inline == "" && !isBlank(e.src[after.span.end:e.lineEnd(after.span.end)]))) {
+		after = nil
+	}
+	e.insertAt(block, after, &w)
+}
+
+func (e *confEditor) insertLine(block *Directive, format string, args ...any) {
+	var w confWriter
+	w.line(format, args...)
+	e.insert(block, &w)
+}
+
+func (e *confEditor) updateRouterID(iface *Directive, routerID string) {
+	// the comment written by MarshalRadvdConfig, see InstanceFromInterface
+	comments := e.src[iface.span.comment:iface.span.start]
+	if n := bytes.Index(comments, []byte("# RouterID:")); n >= 0 {
+		start := iface.span.comment + n
+		end := e.lineEnd(start)
+		if routerID == "" {
+			e.replace(start, end, "")
+		} else {
+			e.replace(start, end, "# RouterID: "+routerID+"\n")
+		}
+		return
+	}
+	if routerID != "" {
+		ls := e.lineStart(iface.span.start)
+		e.replace(ls, ls, "# RouterID: "+routerID+"\n")
+	}
+}
+
+// updateOptions changes the options whose values differ, in place.
+func (e *confEditor) updateOptions(block *Directive, old, new []option) {
+	for n := range new {
+		if old[n].value == new[n].value {
+			continue
+		}
+		// radvd uses the last occurrence of an option
+		var found *Directive
+		for _, d := range block.Block {
+			if d.Name == new[n].name && !d.IsBlock {
+				found = d
+			}
+		}
+		switch {
+		case found == nil:
+			e.insertOption(block, new[n])
+		case new[n].value == "":
+			e.delete(found)
+		default:
+			e.replace(found.span.start, found.span.end, new[n].name+" "+new[n].value+";")
+		}
+	}
+}
+
+// updateExtra deletes and inserts the unmodelled directives, which are compared as text.
+func (e *confEditor) updateExtra(block *Directive, old, new []string) {
+	remaining := make(map[string]int)
+	for _, x := range new {
+		remaining[x]++
+	}
+	removed := make(map[string]int)
+	for _, x := range old {
+		if remaining[x] > 0 {
+			remaining[x]--
+			continue
+		}
+		removed[x]++
+	}
+	for _, d := range block.Block {
+		if s := d.String(); removed[s] > 0 {
+			removed[s]--
+			e.delete(d)
+		}
+	}
+	kept := make(map[string]int)
+	for _, x := range old {
+		kept[x]++
+	}
+	for _, x := range new {
+		if kept[x] > 0 {
+			kept[x]--
+			continue
+		}
+		e.insertLine(block, "%s", x)
+	}
+}
+
+// findBlock returns the block with the name and the argument.
+func findBlock(parent *Directive, name, arg string) *Directive {
+	for _, d := range parent.Block {
+		if d.Name != name || !d.IsBlock {
+			continue
+		}
+		for _, a := range d.Args {
+			if a == arg {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// blockEntry is a block of radvd.conf, such as a prefix of "prefix p { ... };"
+// or an address of "RDNSS a b { ... };", with its options and extra directives.
+type blockEntry struct {
+	key     string
+	options []option
+	extra   []string
+	write   func(w *confWriter)
+}
+
+func prefixEntries(prefixes []Prefix) []blockEntry {
+	var entries []blockEntry
+	for _, p := range prefixes {
+		entries = append(entries, blockEntry{p.Prefix, prefixOptions(p), p.Extra, func(w *confWriter) { writePrefix(w, p) }})
+	}
+	return entries
+}
+
+func nat64PrefixEntries(prefixes []NAT64Prefix) []blockEntry {
+	var entries []blockEntry
+	for _, p := range prefixes {
+		entries = append(entries, blockEntry{p.Prefix, nat64PrefixOptions(p), p.Extra, func(w *confWriter) { writeNAT64Prefix(w, p) }})
+	}
+	return entries
+}
+
+func routeEntries(routes []Route) []blockEntry {
+	var entries []blockEntry
+	for _, r := range routes {
+		entries = append(entries, blockEntry{r.Route, routeOptions(r), r.Extra, func(w *confWriter) { writeRoute(w, r) }})
+	}
+	return entries
+}
+
+// updateBlocks edits the blocks named name that have a single key, e.g. "route r { ... };".
+func (e *confEditor) updateBlocks(iface *Directive, name string, old, new []blockEntry) {
+	olds := make(map[string]blockEntry)
+	for _, o := range old {
+		olds[o.key] = o
+	}
+	news := make(map[string]bool)
+	for _, n := range new {
+		news[n.key] = true
+		o, ok := olds[n.key]
+		if !ok {
+			var w confWriter
+			n.write(&w)
+			e.insert(iface, &w)
+			continue
+		}
+		block := findBlock(iface, name, n.key)
+		e.updateOptions(block, o.options, n.options)
+		e.updateExtra(block, o.extra, n.extra)
+	}
+	for _, o := range old {
+		if !news[o.key] {
+			e.delete(findBlock(iface, name, o.key))
+		}
+	}
+}
+
+func rdnssEntries(rdnss []RDNSS) []blockEntry {
+	var entries []blockEntry
+	for _, r := range rdnss {
+		entries = append(entries, blockEntry{r.Address, rdnssOptions(r), r.Extra, func(w *confWriter) { writeRDNSS(w, r) }})
+	}
+	return entries
+}
+
+func dnsslEntries(dnssl []DNSSL) []blockEntry {
+	var entries []blockEntry
+	for _, d := range dnssl {
+		entries = append(entries, blockEntry{d.Domain, dnsslOptions(d), d.Extra, func(w *confWriter) { writeDNSSL(w, d) }})
+	}
+	return entries
+}
+
+// updateMulti edits the blocks named name: a key that is removed or
+// changed is taken out of its block, a changed one is written as a block
+// of its own. A block with a single key is edited in place.
+func (e *confEditor) updateMulti(iface *Directive, name string, old, new []blockEntry) {
+	olds := make(map[string]blockEntry)
+	for _, o := range old {
+		olds[o.key] = o
+	}
+	news := make(map[string]blockEntry)
+	for _, n := range new {
+		news[n.key] = n
+	}
+	for _, d := range iface.Block {
+		if d.Name != name || !d.IsBlock || len(d.Args) == 0 {
+			continue
+		}
+		var keep []string
+		for _, a := range d.Args {
+			n, ok := news[a]
+			o := olds[a]
+			if ok && slices.Equal(o.options, n.options) && slices.Equal(o.extra, n.extra) {
+				keep = append(keep, a)
+				continue
+			}
+			if ok && len(d.Args) == 1 {
+				e.updateOptions(d, o.options, n.options)
+				e.updateExtra(d, o.extra, n.extra)
+				keep = append(keep, a)
+				continue
+			}
+			if ok {
+				var w confWriter
+				n.write(&w)
+				e.insert(iface, &w)
+			}
+		}
+		switch {
+		case len(keep) == 0:
+			e.delete(d)
+		case len(keep) < len(d.Args):
+			args := d.span.args
+			e.replace(args[0][0], args[len(args)-1][1], strings.Join(keep, " "))
+		}
+	}
+	for _, n := range new {
+		if _, ok := olds[n.key]; !ok {
+			var w confWriter
+			n.write(&w)
+			e.insert(iface, &w)
+		}
+	}
+}
+
+// updateAddresses edits a block of addresses such as "clients { ... };".
+func (e *confEditor) updateAddresses(iface *Directive, name string, old, new []string) {
+	var block *Directive
+	for _, d := range iface.Block {
+		if d.Name == name && d.IsBlock {
+			block = d
+		}
+	}
+	switch {
+	case block == nil && len(new) > 0:
+		var w confWriter
+		writeAddresses(&w, name, new)
+		e.insert(iface, &w)
+		return
+	case block == nil:
+		return
+	case len(new) == 0:
+		e.delete(block)
+		return
+	}
+	news := make(map[string]bool)
+	for _, a := range new {
+		news[a] = true
+	}
+	olds := make(map[string]bool)
+	for _, a := range block.Block {
+		olds[a.Name] = true
+		if !news[a.Name] {
+			e.delete(a)
+		}
+	}
+	for _, a := range new {
+		if !olds[a] {
+			e.insertLine(block, "%s;", a)
+		}
+	}
+}
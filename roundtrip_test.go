@@ -0,0 +1,99 @@
+package radvd_manager
+
+import (
+	"strings"
+	"testing"
+)
+
+const commentedConf = `# RouterID: fc00:abcd::a
+# ID: 1
+interface eth1
+{
+	AdvSendAdvert on;   # send RAs
+	MaxRtrAdvInterval 10;
+	# unknown to the API
+	AdvLinkMTU 1500;
+	FutureOption 42;
+	prefix 2001:db8:1::/64 { AdvOnLink on; AdvAutonomous on; };
+};
+# trailing comment
+`
+
+func TestUpdateRadvdConfKeepsUnchanged(t *testing.T) {
+	i, err := parseRadvdConf("1.conf", []byte(commentedConf), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := UpdateRadvdConf("1.conf", []byte(commentedConf), i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != commentedConf {
+		t.Fatalf("update without changes rewrote the file:\n%s", out)
+	}
+}
+
+func TestUpdateRadvdConfInPlace(t *testing.T) {
+	i, err := parseRadvdConf("1.conf", []byte(commentedConf), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.MaxRtrAdvInterval = 20
+	i.Prefixes = append(i.Prefixes, Prefix{Prefix: "2001:db8:2::/64", AdvOnLink: true})
+	out, err := UpdateRadvdConf("1.conf", []byte(commentedConf), i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\tAdvSendAdvert on;   # send RAs\n\tMaxRtrAdvInterval 20;\n",
+		"\t# unknown to the API\n",
+		"\tFutureOption 42;\n",
+		"prefix 2001:db8:2::/64",
+		"# trailing comment\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("updated config does not contain %q:\n%s", want, out)
+		}
+	}
+	got, err := parseRadvdConf("1.conf", out, 1)
+	if err != nil {
+		t.Fatalf("parse of the updated config: %v\n%s", err, out)
+	}
+	if !got.Equal(i) {
+		t.Fatalf("updated config is %+v, want %+v", got, i)
+	}
+}
+
+func TestFormatRadvdConf(t *testing.T) {
+	conf, err := ParseRadvdConf("1.conf", []byte(commentedConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := FormatRadvdConf(conf)
+	want := `# RouterID: fc00:abcd::a
+# ID: 1
+interface eth1 {
+    AdvSendAdvert on; # send RAs
+    MaxRtrAdvInterval 10;
+    # unknown to the API
+    AdvLinkMTU 1500;
+    FutureOption 42;
+    prefix 2001:db8:1::/64 {
+        AdvOnLink on;
+        AdvAutonomous on;
+    };
+};
+# trailing comment
+`
+	if string(out) != want {
+		t.Fatalf("FormatRadvdConf =\n%s\nwant\n%s", out, want)
+	}
+	// formatting is idempotent
+	conf, err = ParseRadvdConf("1.conf", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again := FormatRadvdConf(conf); string(again) != want {
+		t.Fatalf("second FormatRadvdConf =\n%s", again)
+	}
+}
@@ -0,0 +1,311 @@
+package radvd_manager
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateFailed     = "failed"
+	StateStopped    = "stopped"
+
+	logLines = 20
+)
+
+var errNotSupervised = errors.New("radvd instance is not supervised")
+
+// ErrNotRunning is returned by Reload when no radvd process runs for the instance.
+var ErrNotRunning = errors.New("radvd instance is not running")
+
+// Supervisor owns the radvd processes. Each instance runs in the foreground
+// as a child of the supervisor, so that exits are detected immediately.
+// radvd logs to its own log file, see Paths.LogFile.
+// A crashed instance is restarted with exponential backoff, and marked as
+// failed when it crashes more than MaxRestarts times in a row.
+type Supervisor struct {
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxRestarts int
+	// A process that runs longer than ResetAfter resets the backoff and the crash count.
+	ResetAfter time.Duration
+	Logger     *slog.Logger
+
+	exec      Executor
+	fs        FileSystem
+	paths     Paths
+	mu        sync.Mutex
+	processes map[uint32]*process
+}
+
+// Status is the runtime status of a supervised instance.
+type Status struct {
+	PID      int
+	State    string
+	Restarts uint32
+	LastExit string
+	// LastStderr are the last lines of the log file of radvd
+	LastStderr []string
+}
+
+type process struct {
+	id       uint32
+	pid      int
+	state    string
+	restarts uint32
+	lastExit string
+	wait     func() error
+	stopping bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewSupervisor(exec Executor, fs FileSystem, paths Paths, logger *slog.Logger) *Supervisor {
+	return &Supervisor{
+		exec:        exec,
+		fs:          fs,
+		paths:       paths,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Minute,
+		MaxRestarts: 5,
+		ResetAfter:  5 * time.Minute,
+		Logger:      logger,
+		processes:   make(map[uint32]*process),
+	}
+}
+
+// Start starts radvd for the instance and supervises it.
+func (s *Supervisor) Start(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.processes[uint32(id)]; ok && (p.state == StateRunning || p.state == StateRestarting) {
+		return fmt.Errorf("radvd instance %d is already running", id)
+	}
+	p := &process{
+		id:   uint32(id),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := s.spawn(p); err != nil {
+		return err
+	}
+	s.processes[p.id] = p
+	go s.supervise(p)
+
+	return nil
+}
+
+// Adopt supervises a radvd process that was not started by this supervisor,
+// e.g. one left running by a previous server. Since it is not a child, its
+// exit is detected by polling.
+func (s *Supervisor) Adopt(id int, pid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := &process{
+		id:    uint32(id),
+		pid:   pid,
+		state: StateRunning,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	p.wait = func() error {
+		for {
+			if err := s.exec.Signal(pid, 0); err != nil {
+				return fmt.Errorf("adopted process %d exited", pid)
+			}
+			time.Sleep(time.Second)
+		}
+	}
+	s.processes[p.id] = p
+	go s.supervise(p)
+}
+
+// Reload makes the running radvd re-read its config file. An instance that
+// is waiting to be restarted reads the config file when it is respawned.
+func (s *Supervisor) Reload(id int) error {
+	s.mu.Lock()
+	p, ok := s.processes[uint32(id)]
+	if !ok {
+		s.mu.Unlock()
+		return errNotSupervised
+	}
+	pid, state := p.pid, p.state
+	s.mu.Unlock()
+	switch state {
+	case StateRunning:
+	case StateRestarting:
+		return nil
+	default:
+		return fmt.Errorf("radvd instance %d is %s", id, state)
+	}
+	if err := s.exec.Signal(pid, syscall.SIGHUP); err != nil {
+		return fmt.Errorf("failed to reload radvd: %w", err)
+	}
+	return nil
+}
+
+// Stop terminates the instance and stops supervising it.
+func (s *Supervisor) Stop(id int) error {
+	s.mu.Lock()
+	p, ok := s.processes[uint32(id)]
+	if !ok {
+		s.mu.Unlock()
+		return errNotSupervised
+	}
+	delete(s.processes, uint32(id))
+	if !p.stopping {
+		p.stopping = true
+		close(p.stop)
+	}
+	pid, state := p.pid, p.state
+	s.mu.Unlock()
+
+	if state == StateRunning {
+		if err := s.exec.Signal(pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("failed to stop radvd: %w", err)
+		}
+		select {
+		case <-p.done:
+		case <-time.After(5 * time.Second):
+			s.exec.Signal(pid, syscall.SIGKILL)
+			<-p.done
+		}
+	}
+
+	return nil
+}
+
+// IDs returns the supervised instance IDs.
+func (s *Supervisor) IDs() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]int, 0, len(s.processes))
+	for id := range s.processes {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Status returns the runtime status of a supervised instance.
+func (s *Supervisor) Status(id int) (Status, bool) {
+	s.mu.Lock()
+	p, ok := s.processes[uint32(id)]
+	if !ok {
+		s.mu.Unlock()
+		return Status{}, false
+	}
+	status := Status{
+		State:    p.state,
+		Restarts: p.restarts,
+		LastExit: p.lastExit,
+	}
+	if p.state == StateRunning {
+		status.PID = p.pid
+	}
+	s.mu.Unlock()
+	status.LastStderr = s.logTail(id)
+	return status, true
+}
+
+// spawn starts radvd in the foreground. It must be called with s.mu held.
+func (s *Supervisor) spawn(p *process) error {
+	proc, err := s.exec.Start(s.paths.Radvd, []string{
+		"-n",
+		"-m", "logfile",
+		"-l", s.paths.LogFile(int(p.id)),
+		"-C", s.paths.ConfFile(int(p.id)),
+		"-p", s.paths.PIDFile(int(p.id)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start radvd: %w", err)
+	}
+	p.pid = proc.Pid()
+	p.state = StateRunning
+	p.wait = proc.Wait
+	return nil
+}
+
+func (s *Supervisor) supervise(p *process) {
+	defer close(p.done)
+	backoff := s.MinBackoff
+	crashes := 0
+	for {
+		started := time.Now()
+		err := p.wait()
+
+		s.mu.Lock()
+		p.lastExit = err.Error()
+		if p.stopping {
+			p.state = StateStopped
+			s.mu.Unlock()
+			return
+		}
+		if time.Since(started) > s.ResetAfter {
+			backoff = s.MinBackoff
+			crashes = 0
+		}
+		crashes++
+		if crashes > s.MaxRestarts {
+			p.state = StateFailed
+			s.mu.Unlock()
+			s.logger().Error("radvd is crash looping, giving up", "instance", p.id, "exit", p.lastExit)
+			return
+		}
+		p.state = StateRestarting
+		s.mu.Unlock()
+		s.logger().Error("radvd exited, restarting", "instance", p.id, "exit", p.lastExit, "backoff", backoff.String())
+
+		select {
+		case <-time.After(backoff):
+		case <-p.stop:
+			s.mu.Lock()
+			p.state = StateStopped
+			s.mu.Unlock()
+			return
+		}
+		backoff = min(backoff*2, s.MaxBackoff)
+
+		s.mu.Lock()
+		if p.stopping {
+			p.state = StateStopped
+			s.mu.Unlock()
+			return
+		}
+		p.restarts++
+		if err := s.spawn(p); err != nil {
+			p.wait = func() error { return err }
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Supervisor) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
+// logTail returns the last lines of the log file of the instance.
+func (s *Supervisor) logTail(id int) []string {
+	data, err := s.fs.ReadFile(s.paths.LogFile(id))
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	if len(lines) > logLines {
+		lines = lines[len(lines)-logLines:]
+	}
+	return lines
+}
@@ -0,0 +1,83 @@
+package radvd_manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSupervisorRestartsWithBackoff(t *testing.T) {
+	m, exec, _ := newTestManager()
+	s := m.Supervisor
+	s.MinBackoff = 20 * time.Millisecond
+	s.MaxBackoff = 40 * time.Millisecond
+	if err := s.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	pid := waitState(t, m, 1, StateRunning).PID
+	for n, want := range []time.Duration{20, 40, 40} {
+		crashed := time.Now()
+		exec.Crash(pid)
+		waitState(t, m, 1, StateRestarting)
+		status := waitState(t, m, 1, StateRunning)
+		if elapsed := time.Since(crashed); elapsed < want*time.Millisecond {
+			t.Errorf("restart %d after %v, want at least %v", n+1, elapsed, want*time.Millisecond)
+		}
+		if status.PID == pid {
+			t.Fatalf("restart %d: PID %d was not replaced", n+1, pid)
+		}
+		if status.Restarts != uint32(n+1) || status.LastExit != "exit status 1" {
+			t.Errorf("restart %d: status %+v", n+1, status)
+		}
+		pid = status.PID
+	}
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	m, exec, _ := newTestManager()
+	s := m.Supervisor
+	s.MinBackoff = time.Millisecond
+	s.MaxRestarts = 2
+	if err := s.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	for n := range s.MaxRestarts + 1 {
+		status := waitState(t, m, 1, StateRunning)
+		for status.Restarts != uint32(n) {
+			time.Sleep(time.Millisecond)
+			status = waitState(t, m, 1, StateRunning)
+		}
+		exec.Crash(status.PID)
+	}
+	status := waitState(t, m, 1, StateFailed)
+	if status.Restarts != 2 {
+		t.Errorf("Restarts = %d, want 2", status.Restarts)
+	}
+	if pids := exec.Running(); len(pids) != 0 {
+		t.Errorf("processes %v are still running", pids)
+	}
+	// a failed instance can be started again
+	if err := s.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, m, 1, StateRunning)
+}
+
+func TestSupervisorStopDuringBackoff(t *testing.T) {
+	m, exec, _ := newTestManager()
+	s := m.Supervisor
+	s.MinBackoff = time.Minute
+	if err := s.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	exec.Crash(waitState(t, m, 1, StateRunning).PID)
+	waitState(t, m, 1, StateRestarting)
+	if err := s.Stop(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Status(1); ok {
+		t.Fatal("stopped instance is still supervised")
+	}
+	if pids := exec.Running(); len(pids) != 0 {
+		t.Errorf("processes %v are running after Stop", pids)
+	}
+}
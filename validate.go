@@ -0,0 +1,174 @@
+package radvd_manager
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// defaultMaxRtrAdvInterval is used by radvd when MaxRtrAdvInterval is not set (RFC 4861).
+const defaultMaxRtrAdvInterval = 600
+
+// Linux interface names: at most 15 bytes, no "/", ":" or whitespace.
+var ifnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.@-]{1,15}$`)
+
+// DNS search domains: labels of letters, digits and "-", at most 253 bytes.
+var domainRegexp = regexp.MustCompile(`^(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?)(?:\.[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+func isDomain(s string) bool {
+	return len(s) <= 253 && domainRegexp.MatchString(s)
+}
+
+// isPref64 reports whether s is a NAT64 prefix of a length allowed by RFC 8781.
+func isPref64(s string) bool {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil || !prefix.Addr().Is6() || prefix.Masked() != prefix {
+		return false
+	}
+	switch prefix.Bits() {
+	case 32, 40, 48, 56, 64, 96:
+		return true
+	}
+	return false
+}
+
+// isCaptivePortalAPI reports whether s is an https URI (RFC 8908) that can be
+// written as a quoted string of radvd.conf.
+func isCaptivePortalAPI(s string) bool {
+	if strings.ContainsAny(s, "\"\\") || strings.ContainsFunc(s, unicode.IsControl) || strings.ContainsFunc(s, unicode.IsSpace) {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+var instanceValidator = sync.OnceValue(func() *validator.Validate {
+	validate := newValidator("json")
+	validate.RegisterValidation("ifname", func(fl validator.FieldLevel) bool {
+		name := fl.Field().String()
+		return ifnameRegexp.MatchString(name) && name != "." && name != ".."
+	})
+	validate.RegisterStructValidation(validateIntervals, Instance{})
+	validate.RegisterStructValidation(validateLifetimes, Prefix{})
+	return validate
+})
+
+// newValidator returns a validator that names the fields by the given struct tag
+// and knows the validations shared by instances and policies.
+func newValidator(tag string) *validator.Validate {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.Split(f.Tag.Get(tag), ",")[0]
+	})
+	validate.RegisterValidation("domain", func(fl validator.FieldLevel) bool {
+		return isDomain(fl.Field().String())
+	})
+	validate.RegisterValidation("pref64", func(fl validator.FieldLevel) bool {
+		return isPref64(fl.Field().String())
+	})
+	validate.RegisterValidation("captiveportal", func(fl validator.FieldLevel) bool {
+		return isCaptivePortalAPI(fl.Field().String())
+	})
+	validate.RegisterValidation("unicast6", func(fl validator.FieldLevel) bool {
+		addr, err := netip.ParseAddr(fl.Field().String())
+		if err != nil || !addr.Is6() || addr.Is4In6() {
+			return false
+		}
+		return addr.IsLinkLocalUnicast() || addr.IsGlobalUnicast()
+	})
+	return validate
+}
+
+// validateIntervals checks the relations between the intervals and lifetimes (RFC 4861 6.2.1).
+func validateIntervals(sl validator.StructLevel) {
+	i := sl.Current().Interface().(Instance)
+	max := i.MaxRtrAdvInterval
+	if max == 0 {
+		max = defaultMaxRtrAdvInterval
+	}
+	if i.MinRtrAdvInterval != 0 && i.MinRtrAdvInterval*4 > max*3 {
+		sl.ReportError(i.MinRtrAdvInterval, "min_rtr_adv_interval", "MinRtrAdvInterval", "ltefield_ratio", fmt.Sprint(max))
+	}
+	if i.AdvDefaultLifetime != 0 && i.AdvDefaultLifetime < max {
+		sl.ReportError(i.AdvDefaultLifetime, "adv_default_lifetime", "AdvDefaultLifetime", "gtefield_max", fmt.Sprint(max))
+	}
+}
+
+// validateLifetimes checks that the preferred lifetime of a prefix does not exceed its valid lifetime (RFC 4861 4.6.2).
+func validateLifetimes(sl validator.StructLevel) {
+	p := sl.Current().Interface().(Prefix)
+	if p.AdvPreferredLifetime != nil && *p.AdvPreferredLifetime > p.AdvValidLifetime {
+		sl.ReportError(*p.AdvPreferredLifetime, "adv_preferred_lifetime", "AdvPreferredLifetime", "ltefield_valid", fmt.Sprint(p.AdvValidLifetime))
+	}
+}
+
+// Validate checks the configuration of the instance and returns every violation.
+// Paths are those of the YANG model, as reported by ValidateInstanceJSON.
+func (i *Instance) Validate() []SchemaError {
+	err := instanceValidator().Struct(i)
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		if err != nil {
+			return []SchemaError{{Path: "/radvd:instances/instance", Tag: "operation-failed", Message: err.Error()}}
+		}
+		return nil
+	}
+	var errs []SchemaError
+	for _, e := range verrs {
+		path := strings.TrimPrefix(e.Namespace(), "Instance")
+		path = "/radvd:instances/instance" + strings.ReplaceAll(path, ".", "/")
+		errs = append(errs, SchemaError{Path: path, Tag: "invalid-value", Message: validationMessage(e)})
+	}
+	return errs
+}
+
+func validationMessage(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "ifname":
+		return fmt.Sprintf("%q is not a valid interface name", e.Value())
+	case "ipv6":
+		return fmt.Sprintf("%q is not an IPv6 address", e.Value())
+	case "cidrv6":
+		return fmt.Sprintf("%q is not an IPv6 prefix", e.Value())
+	case "domain":
+		return fmt.Sprintf("%q is not a domain name", e.Value())
+	case "pref64":
+		return fmt.Sprintf("%q is not an IPv6 prefix of length 32, 40, 48, 56, 64 or 96", e.Value())
+	case "captiveportal":
+		return fmt.Sprintf("%q is not an https URI", e.Value())
+	case "unicast6":
+		return fmt.Sprintf("%q is not a link-local or global unicast IPv6 address", e.Value())
+	case "oneof":
+		return fmt.Sprintf("%q is not one of %s", e.Value(), strings.ReplaceAll(e.Param(), " ", ", "))
+	case "min":
+		if e.Kind() == reflect.Slice && e.Param() == "1" {
+			return "must not be empty"
+		}
+		if e.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at least %s entries", e.Param())
+		}
+		return fmt.Sprintf("%v is less than %s", e.Value(), e.Param())
+	case "max":
+		return fmt.Sprintf("%v is greater than %s", e.Value(), e.Param())
+	case "ltefield_ratio":
+		return fmt.Sprintf("%v is greater than 0.75 * max_rtr_adv_interval (%s)", e.Value(), e.Param())
+	case "eq=0|min=1280":
+		return fmt.Sprintf("%v must be 0 or at least 1280", e.Value())
+	case "ltefield_valid":
+		return fmt.Sprintf("%v is greater than adv_valid_lifetime (%s)", e.Value(), e.Param())
+	case "gtefield_max":
+		return fmt.Sprintf("%v must be 0 or at least max_rtr_adv_interval (%s)", e.Value(), e.Param())
+	default:
+		return fmt.Sprintf("%v failed %s", e.Value(), e.Tag())
+	}
+}
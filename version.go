@@ -0,0 +1,89 @@
+package radvd_manager
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RadvdVersion is the version of radvd, as printed by "radvd --version".
+type RadvdVersion struct {
+	Major int
+	Minor int
+}
+
+var radvdVersionRegexp = regexp.MustCompile(`Version (\d+)\.(\d+)`)
+
+// ParseRadvdVersion reads the version from the output of "radvd --version".
+func ParseRadvdVersion(out []byte) (RadvdVersion, error) {
+	m := radvdVersionRegexp.FindSubmatch(out)
+	if m == nil {
+		return RadvdVersion{}, fmt.Errorf("no version in %q", strings.TrimSpace(string(out)))
+	}
+	major, _ := strconv.Atoi(string(m[1]))
+	minor, _ := strconv.Atoi(string(m[2]))
+	return RadvdVersion{major, minor}, nil
+}
+
+func (v RadvdVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v RadvdVersion) AtLeast(o RadvdVersion) bool {
+	return v.Major > o.Major || v.Major == o.Major && v.Minor >= o.Minor
+}
+
+// feature is an option that needs a recent radvd.
+type feature struct {
+	// path of the option in the YANG model
+	path    string
+	since   RadvdVersion
+	enabled func(i *Instance) bool
+}
+
+var features = []feature{
+	// PREF64, RFC 8781
+	{"nat64_prefixes", RadvdVersion{2, 19}, func(i *Instance) bool { return len(i.Nat64Prefixes) > 0 }},
+	// captive portal, RFC 8910
+	{"adv_captive_portal_api", RadvdVersion{2, 20}, func(i *Instance) bool { return i.AdvCaptivePortalAPI != "" }},
+}
+
+// needsVersion reports whether the instance uses an option that depends on the version of radvd.
+func needsVersion(i *Instance) bool {
+	for _, f := range features {
+		if f.enabled(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsupported returns an error for each option of the instance that radvd v does not support.
+func (v RadvdVersion) Unsupported(i *Instance) []SchemaError {
+	var errs []SchemaError
+	for _, f := range features {
+		if f.enabled(i) && !v.AtLeast(f.since) {
+			errs = append(errs, SchemaError{
+				Path:    "/radvd:instances/instance/" + f.path,
+				Tag:     "operation-not-supported",
+				Message: fmt.Sprintf("requires radvd %s or later, found %s", f.since, v),
+			})
+		}
+	}
+	return errs
+}
+
+// UnsupportedError is returned by Configure for an instance that the
+// installed radvd can not run.
+type UnsupportedError struct {
+	Errors []SchemaError
+}
+
+func (e *UnsupportedError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,53 @@
+package radvd_manager
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRadvdVersion(t *testing.T) {
+	for out, want := range map[string]RadvdVersion{
+		"Version 2.19\n": {2, 19},
+		"radvd Version 2.20-dev\nCompiled in settings:": {2, 20},
+	} {
+		got, err := ParseRadvdVersion([]byte(out))
+		if err != nil || got != want {
+			t.Errorf("ParseRadvdVersion(%q) = %v, %v, want %v", out, got, err, want)
+		}
+	}
+	if _, err := ParseRadvdVersion([]byte("radvd: unknown option")); err == nil {
+		t.Error("ParseRadvdVersion accepted output without a version")
+	}
+}
+
+func TestConfigureRadvdVersion(t *testing.T) {
+	nat64 := &Instance{ID: 1, Name: "eth1", Nat64Prefixes: []NAT64Prefix{{Prefix: "64:ff9b::/96"}}}
+	portal := &Instance{ID: 1, Name: "eth1", AdvCaptivePortalAPI: "https://portal.example.com/api"}
+	for _, c := range []struct {
+		version  string
+		instance *Instance
+		path     string
+	}{
+		{"2.18", nat64, "/radvd:instances/instance/nat64_prefixes"},
+		{"2.19", nat64, ""},
+		{"2.19", portal, "/radvd:instances/instance/adv_captive_portal_api"},
+		{"2.20", portal, ""},
+	} {
+		m, exec, fs := newTestManager()
+		exec.Version = c.version
+		err := m.Configure(c.instance)
+		if c.path == "" {
+			if err != nil {
+				t.Errorf("radvd %s: %v", c.version, err)
+			}
+			continue
+		}
+		var unsupported *UnsupportedError
+		if !errors.As(err, &unsupported) || len(unsupported.Errors) != 1 || unsupported.Errors[0].Path != c.path {
+			t.Errorf("radvd %s: Configure = %v, want an *UnsupportedError for %s", c.version, err, c.path)
+		}
+		if _, err := fs.ReadFile(m.paths.ConfFile(1)); err == nil {
+			t.Errorf("radvd %s: the config file of an unsupported instance was written", c.version)
+		}
+	}
+}
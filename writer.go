@@ -0,0 +1,377 @@
+package radvd_manager
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+)
+
+// MarshalRadvdConfig returns the radvd.conf of the instance.
+// Every field is written and every value is checked first, so that a
+// field can not inject radvd directives. The output only depends on the
+// instance; runtime fields such as PID are not written.
+func MarshalRadvdConfig(i *Instance) ([]byte, error) {
+	if err := checkTokens(i); err != nil {
+		return nil, err
+	}
+	var w confWriter
+	if i.RouterID != "" {
+		w.line("# RouterID: %s", i.RouterID)
+	}
+	w.line("# ID: %d", i.ID)
+	w.open("interface %s", i.Name)
+	w.options(interfaceOptions(i))
+	w.extra(i.Extra)
+	for _, p := range i.Prefixes {
+		writePrefix(&w, p)
+	}
+	for _, r := range i.Rdnss {
+		writeRDNSS(&w, r)
+	}
+	for _, d := range i.Dnssl {
+		writeDNSSL(&w, d)
+	}
+	for _, p := range i.Nat64Prefixes {
+		writeNAT64Prefix(&w, p)
+	}
+	for _, r := range i.Routes {
+		writeRoute(&w, r)
+	}
+	// an empty clients block would stop all RAs, so it is only written with clients
+	if len(i.Clients) > 0 {
+		writeClients(&w, i.Clients)
+	}
+	if len(i.AdvRASrcAddress) > 0 {
+		writeAddresses(&w, "AdvRASrcAddress", i.AdvRASrcAddress)
+	}
+	w.close()
+	return w.buf.Bytes(), nil
+}
+
+// option is an option of radvd.conf. An empty value is not written,
+// radvd uses its default then.
+type option struct {
+	name  string
+	value string
+}
+
+func interfaceOptions(i *Instance) []option {
+	return []option{
+		{"AdvSendAdvert", onOff(i.AdvSendAdvert)},
+		{"MinRtrAdvInterval", optionalUint(i.MinRtrAdvInterval)},
+		{"MaxRtrAdvInterval", optionalUint(i.MaxRtrAdvInterval)},
+		{"AdvManagedFlag", onOff(i.AdvManagedFlag)},
+		{"AdvOtherConfigFlag", onOff(i.AdvOtherConfigFlag)},
+		{"AdvDefaultLifetime", strconv.FormatUint(uint64(i.AdvDefaultLifetime), 10)},
+		{"AdvDefaultPreference", i.AdvDefaultPreference},
+		{"AdvLinkMTU", optionalNumber(i.AdvLinkMTU)},
+		{"AdvCurHopLimit", optionalNumber(i.AdvCurHopLimit)},
+		{"AdvReachableTime", optionalNumber(i.AdvReachableTime)},
+		{"AdvRetransTimer", optionalNumber(i.AdvRetransTimer)},
+		{"AdvSourceLLAddress", optionalOnOff(i.AdvSourceLLAddress)},
+		{"UnicastOnly", optionalOnOff(i.UnicastOnly)},
+		{"AdvRASolicitedUnicast", optionalOnOff(i.AdvRASolicitedUnicast)},
+		{"IgnoreIfMissing", optionalOnOff(i.IgnoreIfMissing)},
+		{"MinDelayBetweenRAs", optionalDecimal(i.MinDelayBetweenRAs)},
+		{"AdvHomeAgentFlag", optionalOnOff(i.AdvHomeAgentFlag)},
+		{"AdvHomeAgentInfo", optionalOnOff(i.AdvHomeAgentInfo)},
+		{"HomeAgentLifetime", optionalNumber(i.HomeAgentLifetime)},
+		{"HomeAgentPreference", optionalNumber(i.HomeAgentPreference)},
+		{"AdvMobRtrSupportFlag", optionalOnOff(i.AdvMobRtrSupportFlag)},
+		{"AdvIntervalOpt", optionalOnOff(i.AdvIntervalOpt)},
+		{"AdvCaptivePortalAPI", optionalString(i.AdvCaptivePortalAPI)},
+	}
+}
+
+func prefixOptions(p Prefix) []option {
+	return []option{
+		{"AdvOnLink", onOff(p.AdvOnLink)},
+		{"AdvAutonomous", onOff(p.AdvAutonomous)},
+		{"AdvRouterAddr", onOff(p.AdvRouterAddr)},
+		{"AdvValidLifetime", formatLifetime(p.AdvValidLifetime)},
+		{"AdvPreferredLifetime", optionalLifetime(p.AdvPreferredLifetime)},
+		{"DeprecatePrefix", optionalOnOff(p.DeprecatePrefix)},
+		{"DecrementLifetimes", optionalOnOff(p.DecrementLifetimes)},
+	}
+}
+
+func rdnssOptions(r RDNSS) []option {
+	return []option{
+		{"AdvRDNSSLifetime", formatLifetime(r.AdvRdnssLifetime)},
+		{"FlushRDNSS", optionalOnOff(r.FlushRDNSS)},
+	}
+}
+
+func dnsslOptions(d DNSSL) []option {
+	return []option{
+		{"AdvDNSSLLifetime", formatLifetime(d.AdvDnsslLifetime)},
+		{"FlushDNSSL", optionalOnOff(d.FlushDNSSL)},
+	}
+}
+
+func nat64PrefixOptions(p NAT64Prefix) []option {
+	return []option{
+		{"AdvValidLifetime", optionalNumber(p.AdvValidLifetime)},
+	}
+}
+
+func routeOptions(r Route) []option {
+	return []option{
+		{"AdvRouteLifetime", formatLifetime(r.AdvRouteLifetime)},
+		{"AdvRoutePreference", r.AdvRoutePreference},
+		{"RemoveRoute", optionalOnOff(r.RemoveRoute)},
+	}
+}
+
+func writePrefix(w *confWriter, p Prefix) {
+	w.open("prefix %s", p.Prefix)
+	w.options(prefixOptions(p))
+	w.extra(p.Extra)
+	w.close()
+}
+
+func writeRDNSS(w *confWriter, r RDNSS) {
+	w.open("RDNSS %s", r.Address)
+	w.options(rdnssOptions(r))
+	w.extra(r.Extra)
+	w.close()
+}
+
+func writeDNSSL(w *confWriter, d DNSSL) {
+	w.open("DNSSL %s", d.Domain)
+	w.options(dnsslOptions(d))
+	w.extra(d.Extra)
+	w.close()
+}
+
+func writeNAT64Prefix(w *confWriter, p NAT64Prefix) {
+	w.open("nat64prefix %s", p.Prefix)
+	w.options(nat64PrefixOptions(p))
+	w.extra(p.Extra)
+	w.close()
+}
+
+func writeRoute(w *confWriter, r Route) {
+	w.open("route %s", r.Route)
+	w.options(routeOptions(r))
+	w.extra(r.Extra)
+	w.close()
+}
+
+func writeClients(w *confWriter, clients []string) {
+	writeAddresses(w, "clients", clients)
+}
+
+// writeAddresses writes a block of addresses, e.g. "clients { fe80::1; };".
+func writeAddresses(w *confWriter, name string, addresses []string) {
+	w.open("%s", name)
+	for _, a := range addresses {
+		w.line("%s;", a)
+	}
+	w.close()
+}
+
+// checkTokens makes sure that every string written into radvd.conf is a
+// single token of the expected kind.
+func checkTokens(i *Instance) error {
+	if !ifnameRegexp.MatchString(i.Name) {
+		return fmt.Errorf("unsafe interface name: %q", i.Name)
+	}
+	if i.RouterID != "" && !isAddr6(i.RouterID) {
+		return fmt.Errorf("unsafe router ID: %q", i.RouterID)
+	}
+	if !isPreference(i.AdvDefaultPreference) {
+		return fmt.Errorf("unsafe default preference: %q", i.AdvDefaultPreference)
+	}
+	if err := checkExtra(i.Extra); err != nil {
+		return err
+	}
+	for _, p := range i.Prefixes {
+		if !isPrefix6(p.Prefix) {
+			return fmt.Errorf("unsafe prefix: %q", p.Prefix)
+		}
+		if err := checkExtra(p.Extra); err != nil {
+			return err
+		}
+	}
+	for _, r := range i.Rdnss {
+		if !isAddr6(r.Address) {
+			return fmt.Errorf("unsafe RDNSS address: %q", r.Address)
+		}
+		if err := checkExtra(r.Extra); err != nil {
+			return err
+		}
+	}
+	for _, d := range i.Dnssl {
+		if !isDomain(d.Domain) {
+			return fmt.Errorf("unsafe DNSSL domain: %q", d.Domain)
+		}
+		if err := checkExtra(d.Extra); err != nil {
+			return err
+		}
+	}
+	for _, p := range i.Nat64Prefixes {
+		if !isPrefix6(p.Prefix) {
+			return fmt.Errorf("unsafe NAT64 prefix: %q", p.Prefix)
+		}
+		if err := checkExtra(p.Extra); err != nil {
+			return err
+		}
+	}
+	if i.AdvCaptivePortalAPI != "" && !isCaptivePortalAPI(i.AdvCaptivePortalAPI) {
+		return fmt.Errorf("unsafe captive portal API: %q", i.AdvCaptivePortalAPI)
+	}
+	for _, r := range i.Routes {
+		if !isPrefix6(r.Route) {
+			return fmt.Errorf("unsafe route: %q", r.Route)
+		}
+		if !isPreference(r.AdvRoutePreference) {
+			return fmt.Errorf("unsafe route preference: %q", r.AdvRoutePreference)
+		}
+		if err := checkExtra(r.Extra); err != nil {
+			return err
+		}
+	}
+	for _, c := range i.Clients {
+		if !isAddr6(c) {
+			return fmt.Errorf("unsafe client address: %q", c)
+		}
+	}
+	for _, a := range i.AdvRASrcAddress {
+		if !isAddr6(a) {
+			return fmt.Errorf("unsafe RA source address: %q", a)
+		}
+	}
+	if i.MinDelayBetweenRAs != nil && (math.IsNaN(*i.MinDelayBetweenRAs) || math.IsInf(*i.MinDelayBetweenRAs, 0) || *i.MinDelayBetweenRAs < 0) {
+		return fmt.Errorf("unsafe MinDelayBetweenRAs: %v", *i.MinDelayBetweenRAs)
+	}
+	return nil
+}
+
+// checkExtra makes sure that each extra directive is exactly one
+// statement, so that it can not close the enclosing block.
+func checkExtra(extra []string) error {
+	for _, e := range extra {
+		d, err := parseDirective(e)
+		if err != nil {
+			return fmt.Errorf("unsafe extra directive: %v", err)
+		}
+		if d.Name == "interface" {
+			return fmt.Errorf("unsafe extra directive: %q", e)
+		}
+	}
+	return nil
+}
+
+// isAddr6 reports whether s is an IPv6 address. Zones are rejected,
+// they may contain any character.
+func isAddr6(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	return err == nil && addr.Is6() && addr.Zone() == ""
+}
+
+func isPrefix6(s string) bool {
+	prefix, err := netip.ParsePrefix(s)
+	return err == nil && prefix.Addr().Is6()
+}
+
+func isPreference(s string) bool {
+	return s == "" || s == "low" || s == "medium" || s == "high"
+}
+
+func optionalUint(value uint32) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(value), 10)
+}
+
+func optionalNumber(value *uint32) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*value), 10)
+}
+
+func optionalDecimal(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+// optionalString quotes a string that is only written if set.
+func optionalString(s string) string {
+	if s == "" {
+		return ""
+	}
+	return `"` + s + `"`
+}
+
+func optionalLifetime(lifetime *uint32) string {
+	if lifetime == nil {
+		return ""
+	}
+	return formatLifetime(*lifetime)
+}
+
+func optionalOnOff(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return onOff(*b)
+}
+
+func formatLifetime(lifetime uint32) string {
+	if lifetime == math.MaxUint32 {
+		return "infinity"
+	}
+	return strconv.FormatUint(uint64(lifetime), 10)
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// confWriter writes radvd.conf with one statement per line.
+type confWriter struct {
+	buf    bytes.Buffer
+	indent int
+}
+
+func (w *confWriter) line(format string, args ...any) {
+	for n := 0; n < w.indent; n++ {
+		w.buf.WriteString("    ")
+	}
+	fmt.Fprintf(&w.buf, format, args...)
+	w.buf.WriteByte('\n')
+}
+
+func (w *confWriter) open(format string, args ...any) {
+	w.line(format+" {", args...)
+	w.indent++
+}
+
+func (w *confWriter) close() {
+	w.indent--
+	w.line("};")
+}
+
+func (w *confWriter) options(options []option) {
+	for _, o := range options {
+		if o.value != "" {
+			w.line("%s %s;", o.name, o.value)
+		}
+	}
+}
+
+func (w *confWriter) extra(extra []string) {
+	for _, e := range extra {
+		w.line("%s", e)
+	}
+}
@@ -0,0 +1,57 @@
+package radvd_manager
+
+import "testing"
+
+func TestMarshalParseRoundTrip(t *testing.T) {
+	i := &Instance{
+		ID:                   7,
+		RouterID:             "fc00:abcd::a",
+		Name:                 "eth1",
+		AdvSendAdvert:        true,
+		MinRtrAdvInterval:    3,
+		MaxRtrAdvInterval:    10,
+		AdvDefaultLifetime:   600,
+		AdvDefaultPreference: "high",
+		AdvLinkMTU:           newValue(uint32(1500)),
+		UnicastOnly:          newValue(false),
+		MinDelayBetweenRAs:   newValue(0.5),
+		Prefixes: []Prefix{{
+			Prefix:               "2001:db8:1::/64",
+			AdvOnLink:            true,
+			AdvAutonomous:        true,
+			AdvValidLifetime:     86400,
+			AdvPreferredLifetime: newValue(uint32(14400)),
+		}},
+		Rdnss:         []RDNSS{{Address: "2001:db8::53", AdvRdnssLifetime: 1200}},
+		Dnssl:         []DNSSL{{Domain: "a.example.com", AdvDnsslLifetime: 1800}},
+		Nat64Prefixes: []NAT64Prefix{{Prefix: "64:ff9b::/96"}},
+		Routes:        []Route{{Route: "2001:db8:2::/64", AdvRouteLifetime: 1800, AdvRoutePreference: "low"}},
+		Clients:       []string{"fe80::1", "fe80::2"},
+		Extra:         []string{"FutureOption 42;"},
+	}
+	data, err := MarshalRadvdConfig(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseRadvdConf("7.conf", data, 7)
+	if err != nil {
+		t.Fatalf("parse of\n%s: %v", data, err)
+	}
+	if !got.Equal(i) {
+		t.Fatalf("round trip of\n%s\n= %+v, want %+v", data, got, i)
+	}
+}
+
+func TestMarshalRejectsInjection(t *testing.T) {
+	for _, i := range []*Instance{
+		{Name: "eth1; };"},
+		{Name: "eth1", Prefixes: []Prefix{{Prefix: "2001:db8::/64 { };"}}},
+		{Name: "eth1", Dnssl: []DNSSL{{Domain: "a.example.com;"}}},
+		{Name: "eth1", Extra: []string{"FutureOption 42; }; interface eth0 { FutureOption 42;"}},
+		{Name: "eth1", Extra: []string{"interface eth0 { };"}},
+	} {
+		if data, err := MarshalRadvdConfig(i); err == nil {
+			t.Errorf("MarshalRadvdConfig(%+v) = \n%s", i, data)
+		}
+	}
+}
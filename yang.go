@@ -0,0 +1,548 @@
+package radvd_manager
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//go:embed yang/radvd.yang
+var radvdYang string
+
+// YangModule is the YANG module describing the REST API (yang/radvd.yang).
+var YangModule = radvdYang
+
+// SchemaError is a violation of the YANG model.
+// Tag is the RESTCONF error-tag, Path is the path of the offending node.
+type SchemaError struct {
+	Path    string
+	Tag     string
+	Message string
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidateInstanceJSON validates a JSON encoded instance against the YANG model
+// and returns every violation. Nodes marked "config false" are accepted and ignored.
+func ValidateInstanceJSON(data []byte) []SchemaError {
+	schema, err := instanceSchema()
+	if err != nil {
+		return []SchemaError{{Path: "/", Tag: "operation-failed", Message: err.Error()}}
+	}
+	var v any
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return []SchemaError{{Path: "/", Tag: "malformed-message", Message: err.Error()}}
+	}
+	var errs []SchemaError
+	schema.validate("/radvd:instances/instance", v, &errs)
+	return errs
+}
+
+// decimalRegexp is the lexical form of a decimal64 value (RFC 7950 9.3.1).
+var decimalRegexp = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?$`)
+
+// EncodeInstanceYangJSON converts an instance, as decoded with json.Decoder.UseNumber,
+// to its RFC 7951 encoding: decimal64 leaves are JSON strings there.
+func EncodeInstanceYangJSON(instance any) (any, error) {
+	schema, err := instanceSchema()
+	if err != nil {
+		return nil, err
+	}
+	return schema.mapLeaves(instance, "decimal64", func(v any) any {
+		if num, ok := v.(json.Number); ok {
+			return num.String()
+		}
+		return v
+	}), nil
+}
+
+// DecodeInstanceYangJSON converts an RFC 7951 encoded instance to the JSON
+// encoding of Instance, which has decimal64 leaves as numbers. Values that are
+// not decimal numbers are kept as they are, for ValidateInstanceJSON to report.
+func DecodeInstanceYangJSON(data []byte) ([]byte, error) {
+	schema, err := instanceSchema()
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	v = schema.mapLeaves(v, "decimal64", func(v any) any {
+		if s, ok := v.(string); ok && decimalRegexp.MatchString(s) {
+			return json.Number(strings.TrimPrefix(s, "+"))
+		}
+		return v
+	})
+	return json.Marshal(v)
+}
+
+// yangStmt is a statement of the YANG module.
+type yangStmt struct {
+	keyword string
+	arg     string
+	subs    []*yangStmt
+}
+
+func (s *yangStmt) sub(keyword string) *yangStmt {
+	for _, sub := range s.subs {
+		if sub.keyword == keyword {
+			return sub
+		}
+	}
+	return nil
+}
+
+// yangNode is a data node of the schema.
+type yangNode struct {
+	kind      string // container, list, leaf, leaf-list
+	name      string
+	key       string
+	mandatory bool
+	config    bool
+	typ       *yangType
+	children  []*yangNode
+}
+
+type yangType struct {
+	base     string
+	ranges   [][2]float64
+	length   [][2]float64
+	patterns []*regexp.Regexp
+	enums    []string
+	// fractionDigits of decimal64
+	fractionDigits int
+}
+
+var instanceSchema = sync.OnceValues(func() (*yangNode, error) {
+	module, err := parseYang(radvdYang)
+	if err != nil {
+		return nil, err
+	}
+	typedefs := make(map[string]*yangStmt)
+	for _, s := range module.subs {
+		if s.keyword == "typedef" {
+			typedefs[s.arg] = s
+		}
+	}
+	instances := module.sub("container")
+	if instances == nil || instances.sub("list") == nil {
+		return nil, fmt.Errorf("yang: instances/instance not found")
+	}
+	return buildNode(instances.sub("list"), typedefs)
+})
+
+func buildNode(s *yangStmt, typedefs map[string]*yangStmt) (*yangNode, error) {
+	node := &yangNode{kind: s.keyword, name: s.arg, config: true}
+	for _, sub := range s.subs {
+		switch sub.keyword {
+		case "key":
+			node.key = sub.arg
+		case "mandatory":
+			node.mandatory = sub.arg == "true"
+		case "config":
+			node.config = sub.arg != "false"
+		case "type":
+			typ, err := buildType(sub, typedefs)
+			if err != nil {
+				return nil, fmt.Errorf("yang: %s: %w", s.arg, err)
+			}
+			node.typ = typ
+		case "container", "list", "leaf", "leaf-list":
+			child, err := buildNode(sub, typedefs)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		}
+	}
+	return node, nil
+}
+
+func buildType(s *yangStmt, typedefs map[string]*yangStmt) (*yangType, error) {
+	typ := &yangType{base: s.arg}
+	if def, ok := typedefs[s.arg]; ok {
+		base, err := buildType(def.sub("type"), typedefs)
+		if err != nil {
+			return nil, err
+		}
+		typ = base
+	}
+	for _, sub := range s.subs {
+		var err error
+		switch sub.keyword {
+		case "range":
+			typ.ranges, err = parseYangRange(sub.arg)
+		case "length":
+			typ.length, err = parseYangRange(sub.arg)
+		case "pattern":
+			var re *regexp.Regexp
+			re, err = regexp.Compile("^(?:" + sub.arg + ")$")
+			typ.patterns = append(typ.patterns, re)
+		case "enum":
+			typ.enums = append(typ.enums, sub.arg)
+		case "fraction-digits":
+			typ.fractionDigits, err = strconv.Atoi(sub.arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return typ, nil
+}
+
+func parseYangRange(arg string) ([][2]float64, error) {
+	var ranges [][2]float64
+	for _, part := range strings.Split(arg, "|") {
+		lo, hi, found := strings.Cut(strings.TrimSpace(part), "..")
+		if !found {
+			hi = lo
+		}
+		l, err := parseYangBound(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q", arg)
+		}
+		h, err := parseYangBound(hi)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q", arg)
+		}
+		ranges = append(ranges, [2]float64{l, h})
+	}
+	return ranges, nil
+}
+
+// parseYangBound parses a bound of a range, "min" and "max" are the limits of the type.
+func parseYangBound(s string) (float64, error) {
+	switch s = strings.TrimSpace(s); s {
+	case "min":
+		return math.Inf(-1), nil
+	case "max":
+		return math.Inf(1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func (n *yangNode) child(name string) *yangNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *yangNode) validate(path string, v any, errs *[]SchemaError) {
+	switch n.kind {
+	case "container", "list":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			*errs = append(*errs, SchemaError{Path: path, Tag: "invalid-value", Message: "must be an object"})
+			return
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := n.child(name)
+			if c == nil {
+				*errs = append(*errs, SchemaError{Path: path + "/" + name, Tag: "unknown-element", Message: "unknown element"})
+				continue
+			}
+			if !c.config || obj[name] == nil {
+				continue
+			}
+			c.validateMember(path+"/"+name, obj[name], errs)
+		}
+		for _, c := range n.children {
+			if c.mandatory && obj[c.name] == nil {
+				*errs = append(*errs, SchemaError{Path: path + "/" + c.name, Tag: "missing-element", Message: "mandatory element is missing"})
+			}
+		}
+	case "leaf":
+		n.typ.validate(path, v, errs)
+	}
+}
+
+// mapLeaves replaces the values of the leafs and leaf-lists of type base
+// below the container or list entry v with the result of f.
+func (n *yangNode) mapLeaves(v any, base string, f func(any) any) any {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	for name, value := range obj {
+		c := n.child(name)
+		if c == nil {
+			continue
+		}
+		switch c.kind {
+		case "list", "leaf-list":
+			entries, ok := value.([]any)
+			if !ok {
+				continue
+			}
+			for i, e := range entries {
+				if c.kind == "list" {
+					entries[i] = c.mapLeaves(e, base, f)
+				} else if c.typ.base == base {
+					entries[i] = f(e)
+				}
+			}
+		case "leaf":
+			if c.typ.base == base {
+				obj[name] = f(value)
+			}
+		default:
+			obj[name] = c.mapLeaves(value, base, f)
+		}
+	}
+	return obj
+}
+
+// validateMember validates the JSON member of a child node, which is an
+// array of entries for lists and leaf-lists.
+func (n *yangNode) validateMember(path string, v any, errs *[]SchemaError) {
+	switch n.kind {
+	case "list", "leaf-list":
+		entries, ok := v.([]any)
+		if !ok {
+			*errs = append(*errs, SchemaError{Path: path, Tag: "invalid-value", Message: "must be an array"})
+			return
+		}
+		seen := make(map[string]bool)
+		for i, e := range entries {
+			entryPath := fmt.Sprintf("%s[%d]", path, i)
+			key := fmt.Sprint(e)
+			if n.kind == "list" {
+				n.validate(entryPath, e, errs)
+				obj, _ := e.(map[string]any)
+				if obj[n.key] == nil {
+					*errs = append(*errs, SchemaError{Path: entryPath + "/" + n.key, Tag: "missing-element", Message: "list key is missing"})
+					continue
+				}
+				key = fmt.Sprint(obj[n.key])
+			} else {
+				n.typ.validate(entryPath, e, errs)
+			}
+			if seen[key] {
+				*errs = append(*errs, SchemaError{Path: entryPath, Tag: "data-exists", Message: fmt.Sprintf("duplicate entry %q", key)})
+			}
+			seen[key] = true
+		}
+	default:
+		n.validate(path, v, errs)
+	}
+}
+
+func (t *yangType) validate(path string, v any, errs *[]SchemaError) {
+	invalid := func(format string, args ...any) {
+		*errs = append(*errs, SchemaError{Path: path, Tag: "invalid-value", Message: fmt.Sprintf(format, args...)})
+	}
+	switch t.base {
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			invalid("must be a boolean")
+		}
+	case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		num, ok := v.(json.Number)
+		if !ok {
+			invalid("must be a number")
+			return
+		}
+		f, err := num.Float64()
+		if err != nil || f != math.Trunc(f) {
+			invalid("%s is not an integer", num)
+			return
+		}
+		bits, _ := strconv.Atoi(strings.TrimLeft(t.base, "uint"))
+		lo, hi := -math.Pow(2, float64(bits-1)), math.Pow(2, float64(bits-1))-1
+		if strings.HasPrefix(t.base, "u") {
+			lo, hi = 0, math.Pow(2, float64(bits))-1
+		}
+		if f < lo || f > hi {
+			invalid("%s is out of range of %s", num, t.base)
+			return
+		}
+		if !inRanges(t.ranges, f) {
+			invalid("%s is out of range %s", num, formatRanges(t.ranges))
+		}
+	case "decimal64":
+		num, ok := v.(json.Number)
+		if !ok {
+			invalid("must be a number")
+			return
+		}
+		f, err := num.Float64()
+		if err != nil {
+			invalid("%s is not a decimal number", num)
+			return
+		}
+		if _, fraction, _ := strings.Cut(strings.TrimLeft(num.String(), "-0123456789"), "."); len(fraction) > t.fractionDigits {
+			invalid("%s has more than %d fraction digits", num, t.fractionDigits)
+			return
+		}
+		if !inRanges(t.ranges, f) {
+			invalid("%s is out of range %s", num, formatRanges(t.ranges))
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			invalid("must be a string")
+			return
+		}
+		if !inRanges(t.length, float64(len(s))) {
+			invalid("length of %q is out of range %s", s, formatRanges(t.length))
+		}
+		for _, re := range t.patterns {
+			if !re.MatchString(s) {
+				invalid("%q does not match pattern %s", s, re.String())
+			}
+		}
+	case "enumeration":
+		s, ok := v.(string)
+		if !ok || !is_contain(t.enums, s) {
+			invalid("%v is not one of %s", v, strings.Join(t.enums, ", "))
+		}
+	}
+}
+
+func inRanges(ranges [][2]float64, f float64) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if r[0] <= f && f <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func formatRanges(ranges [][2]float64) string {
+	var parts []string
+	for _, r := range ranges {
+		if r[0] == r[1] {
+			parts = append(parts, formatYangBound(r[0]))
+			continue
+		}
+		parts = append(parts, formatYangBound(r[0])+".."+formatYangBound(r[1]))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func formatYangBound(f float64) string {
+	switch {
+	case math.IsInf(f, -1):
+		return "min"
+	case math.IsInf(f, 1):
+		return "max"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// parseYang parses the statements of a YANG module.
+func parseYang(src string) (*yangStmt, error) {
+	tokens, err := tokenizeYang(src)
+	if err != nil {
+		return nil, err
+	}
+	pos := 0
+	var parse func() (*yangStmt, error)
+	parse = func() (*yangStmt, error) {
+		stmt := &yangStmt{keyword: tokens[pos]}
+		pos++
+		var args []string
+		for pos < len(tokens) && tokens[pos] != "{" && tokens[pos] != ";" {
+			if tokens[pos] != "+" {
+				args = append(args, tokens[pos])
+			}
+			pos++
+		}
+		stmt.arg = strings.Join(args, "")
+		if pos >= len(tokens) {
+			return nil, fmt.Errorf("yang: unexpected end of module after %q", stmt.keyword)
+		}
+		if tokens[pos] == ";" {
+			pos++
+			return stmt, nil
+		}
+		pos++
+		for pos < len(tokens) && tokens[pos] != "}" {
+			sub, err := parse()
+			if err != nil {
+				return nil, err
+			}
+			stmt.subs = append(stmt.subs, sub)
+		}
+		if pos >= len(tokens) {
+			return nil, fmt.Errorf("yang: missing } for %q", stmt.keyword)
+		}
+		pos++
+		return stmt, nil
+	}
+	return parse()
+}
+
+// tokenizeYang splits the module into keywords, arguments and the "{", "}", ";" and "+" tokens.
+// Quoted strings are returned without their quotes.
+func tokenizeYang(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("yang: unterminated comment")
+			}
+			i += end + 4
+		case c == '{' || c == '}' || c == ';' || c == '+':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for j < len(src) && src[j] != c {
+				if c == '"' && src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("yang: unterminated string")
+			}
+			tokens = append(tokens, sb.String())
+			i = j + 1
+		default:
+			j := i
+			for j < len(src) && !unicode.IsSpace(rune(src[j])) && !strings.ContainsRune("{};", rune(src[j])) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
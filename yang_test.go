@@ -0,0 +1,63 @@
+package radvd_manager
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateInstanceJSON(t *testing.T) {
+	valid := `{"id": 1, "name": "eth1", "adv_send_advert": true, "min_delay_between_ras": 0.5,
+		"prefixes": [{"prefix": "2001:db8::/64", "adv_on_link": true}], "state": "running"}`
+	if errs := ValidateInstanceJSON([]byte(valid)); len(errs) != 0 {
+		t.Fatalf("valid instance: %v", errs)
+	}
+	for body, want := range map[string]string{
+		`{"id": 1}`:                           "/radvd:instances/instance/name: mandatory element is missing",
+		`{"id": 1, "name": "eth1", "foo": 1}`: "/radvd:instances/instance/foo: unknown element",
+		`{"id": 1, "name": "eth1", "adv_send_advert": "yes"}`:            "/radvd:instances/instance/adv_send_advert: must be a boolean",
+		`{"id": 1, "name": "eth1", "min_delay_between_ras": 0.1234}`:     "has more than 3 fraction digits",
+		`{"id": 1, "name": "eth1", "min_delay_between_ras": "0.5"}`:      "must be a number",
+		`{"id": 1, "name": "eth1", "prefixes": [{"adv_on_link": true}]}`: "list key is missing",
+	} {
+		errs := ValidateInstanceJSON([]byte(body))
+		if len(errs) == 0 || !strings.Contains(errs[0].Error(), want) {
+			t.Errorf("%s: got %v, want %q", body, errs, want)
+		}
+	}
+}
+
+func TestInstanceYangJSON(t *testing.T) {
+	data, err := DecodeInstanceYangJSON([]byte(`{"id": 1, "name": "eth1", "min_delay_between_ras": "0.5"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := ValidateInstanceJSON(data); len(errs) != 0 {
+		t.Fatalf("decoded instance is invalid: %v", errs)
+	}
+	var i Instance
+	if err := json.Unmarshal(data, &i); err != nil {
+		t.Fatal(err)
+	}
+	if i.MinDelayBetweenRAs == nil || *i.MinDelayBetweenRAs != 0.5 {
+		t.Fatalf("min_delay_between_ras = %v", i.MinDelayBetweenRAs)
+	}
+
+	// a value that is not a decimal number is left to the validation
+	data, err = DecodeInstanceYangJSON([]byte(`{"id": 1, "name": "eth1", "min_delay_between_ras": "Inf"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := ValidateInstanceJSON(data); len(errs) != 1 {
+		t.Fatalf("invalid decimal64 accepted: %s", data)
+	}
+
+	encoded, err := EncodeInstanceYangJSON(map[string]any{"id": json.Number("1"), "min_delay_between_ras": json.Number("0.5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := json.Marshal(encoded)
+	if string(out) != `{"id":1,"min_delay_between_ras":"0.5"}` {
+		t.Fatalf("encoded instance = %s", out)
+	}
+}